@@ -0,0 +1,271 @@
+package postal
+
+import (
+    "container/list"
+    "encoding/binary"
+    "hash"
+    "hash/fnv"
+    "sync"
+
+    expand "github.com/openvenues/gopostal/expand"
+    parser "github.com/openvenues/gopostal/parser"
+)
+
+const DefaultCapacity = 10000
+
+var expandDefaultOptions = expand.GetDefaultExpansionOptions()
+
+type kind uint8
+
+const (
+    kindParse kind = iota
+    kindExpand
+    kindExpandRoot
+)
+
+type key struct {
+    kind kind
+    options uint64
+    input string
+}
+
+type entry struct {
+    key key
+    components []parser.ParsedComponent
+    expansions []string
+}
+
+type Stats struct {
+    Hits uint64
+    Misses uint64
+    Evictions uint64
+    // Number of results currently cached.
+    Len int
+}
+
+// Cache is a size-bounded LRU cache in front of the parser and expansion
+// functions. Its methods have the same signatures as the functions they
+// wrap. Only successful results are cached, and callers get their own copy of
+// each result, so modifying one doesn't affect the cache.
+type Cache struct {
+    mu sync.Mutex
+    capacity int
+    order *list.List
+    entries map[key]*list.Element
+    stats Stats
+
+    // Replaced in tests.
+    parse func(string, parser.ParserOptions) ([]parser.ParsedComponent, error)
+    expand func(string, expand.ExpandOptions) ([]string, error)
+    expandRoot func(string, expand.ExpandOptions) ([]string, error)
+}
+
+// New returns a cache holding up to capacity results, or DefaultCapacity if
+// capacity is not positive.
+func New(capacity int) *Cache {
+    if capacity <= 0 {
+        capacity = DefaultCapacity
+    }
+    return &Cache{
+        capacity: capacity,
+        order: list.New(),
+        entries: make(map[key]*list.Element),
+        parse: parser.ParseAddressOptionsE,
+        expand: expand.ExpandAddressOptionsE,
+        expandRoot: expand.ExpandAddressRootOptionsE,
+    }
+}
+
+// Stats returns the cache's counters since it was created or last purged.
+func (c *Cache) Stats() Stats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    stats := c.stats
+    stats.Len = c.order.Len()
+    return stats
+}
+
+// Purge removes all cached results and resets the counters.
+func (c *Cache) Purge() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    c.order.Init()
+    c.entries = make(map[key]*list.Element)
+    c.stats = Stats{}
+}
+
+func (c *Cache) get(k key) (*entry, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    element, ok := c.entries[k]
+    if !ok {
+        c.stats.Misses++
+        return nil, false
+    }
+
+    c.stats.Hits++
+    c.order.MoveToFront(element)
+    return element.Value.(*entry), true
+}
+
+func (c *Cache) add(e *entry) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    // Another caller may have added the same result while this one was
+    // computing it.
+    if element, ok := c.entries[e.key]; ok {
+        element.Value = e
+        c.order.MoveToFront(element)
+        return
+    }
+
+    c.entries[e.key] = c.order.PushFront(e)
+
+    for c.order.Len() > c.capacity {
+        oldest := c.order.Back()
+        c.order.Remove(oldest)
+        delete(c.entries, oldest.Value.(*entry).key)
+        c.stats.Evictions++
+    }
+}
+
+// Options are hashed from an encoding that lists every field in a fixed order,
+// with strings prefixed by their length, so equal options always hash the same.
+
+func hashParserOptions(options parser.ParserOptions) uint64 {
+    h := fnv.New64a()
+    writeString(h, options.Language)
+    writeString(h, options.Country)
+    return h.Sum64()
+}
+
+func hashExpandOptions(options expand.ExpandOptions) uint64 {
+    h := fnv.New64a()
+
+    var buf []byte
+    buf = binary.AppendUvarint(buf, uint64(len(options.Languages)))
+    h.Write(buf)
+    for _, language := range options.Languages {
+        writeString(h, language)
+    }
+
+    flags := []bool{
+        options.LatinAscii,
+        options.Transliterate,
+        options.StripAccents,
+        options.Decompose,
+        options.Lowercase,
+        options.TrimString,
+        options.ReplaceWordHyphens,
+        options.DeleteWordHyphens,
+        options.ReplaceNumericHyphens,
+        options.DeleteNumericHyphens,
+        options.SplitAlphaFromNumeric,
+        options.DeleteFinalPeriods,
+        options.DeleteAcronymPeriods,
+        options.DropEnglishPossessives,
+        options.DeleteApostrophes,
+        options.ExpandNumex,
+        options.RomanNumerals,
+    }
+    var bits uint64
+    for i, flag := range flags {
+        if flag {
+            bits |= 1 << uint(i)
+        }
+    }
+
+    buf = binary.BigEndian.AppendUint16(buf[:0], options.AddressComponents)
+    buf = binary.BigEndian.AppendUint64(buf, bits)
+    h.Write(buf)
+
+    return h.Sum64()
+}
+
+func writeString(h hash.Hash64, s string) {
+    h.Write(binary.AppendUvarint(nil, uint64(len(s))))
+    h.Write([]byte(s))
+}
+
+func copyComponents(components []parser.ParsedComponent) []parser.ParsedComponent {
+    return append(make([]parser.ParsedComponent, 0, len(components)), components...)
+}
+
+func copyStrings(strs []string) []string {
+    return append(make([]string, 0, len(strs)), strs...)
+}
+
+func (c *Cache) ParseAddressOptionsE(address string, options parser.ParserOptions) ([]parser.ParsedComponent, error) {
+    k := key{kind: kindParse, options: hashParserOptions(options), input: address}
+    if e, ok := c.get(k); ok {
+        return copyComponents(e.components), nil
+    }
+
+    components, err := c.parse(address, options)
+    if err != nil {
+        return nil, err
+    }
+
+    c.add(&entry{key: k, components: copyComponents(components)})
+    return components, nil
+}
+
+func (c *Cache) ParseAddressOptions(address string, options parser.ParserOptions) []parser.ParsedComponent {
+    components, _ := c.ParseAddressOptionsE(address, options)
+    return components
+}
+
+func (c *Cache) ParseAddress(address string) []parser.ParsedComponent {
+    return c.ParseAddressOptions(address, parser.ParserOptions{})
+}
+
+func (c *Cache) expandAddressOptions(address string, options expand.ExpandOptions, root bool) ([]string, error) {
+    k := key{kind: kindExpand, options: hashExpandOptions(options), input: address}
+    fn := c.expand
+    if root {
+        k.kind = kindExpandRoot
+        fn = c.expandRoot
+    }
+
+    if e, ok := c.get(k); ok {
+        return copyStrings(e.expansions), nil
+    }
+
+    expansions, err := fn(address, options)
+    if err != nil {
+        return nil, err
+    }
+
+    c.add(&entry{key: k, expansions: copyStrings(expansions)})
+    return expansions, nil
+}
+
+func (c *Cache) ExpandAddressOptionsE(address string, options expand.ExpandOptions) ([]string, error) {
+    return c.expandAddressOptions(address, options, false)
+}
+
+func (c *Cache) ExpandAddressOptions(address string, options expand.ExpandOptions) []string {
+    expansions, _ := c.ExpandAddressOptionsE(address, options)
+    return expansions
+}
+
+func (c *Cache) ExpandAddress(address string) []string {
+    return c.ExpandAddressOptions(address, expandDefaultOptions)
+}
+
+func (c *Cache) ExpandAddressRootOptionsE(address string, options expand.ExpandOptions) ([]string, error) {
+    return c.expandAddressOptions(address, options, true)
+}
+
+func (c *Cache) ExpandAddressRootOptions(address string, options expand.ExpandOptions) []string {
+    expansions, _ := c.ExpandAddressRootOptionsE(address, options)
+    return expansions
+}
+
+func (c *Cache) ExpandAddressRoot(address string) []string {
+    return c.ExpandAddressRootOptions(address, expandDefaultOptions)
+}
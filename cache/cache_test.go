@@ -0,0 +1,146 @@
+package postal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	expand "github.com/openvenues/gopostal/expand"
+	parser "github.com/openvenues/gopostal/parser"
+)
+
+// newTestCache returns a cache whose backing functions count their calls and
+// return fixed results.
+func newTestCache(capacity int, calls *int) *Cache {
+	c := New(capacity)
+	c.parse = func(address string, options parser.ParserOptions) ([]parser.ParsedComponent, error) {
+		*calls++
+		if address == "fail" {
+			return nil, parser.ErrLibpostal
+		}
+		return []parser.ParsedComponent{{Label: "road", Value: address}}, nil
+	}
+	c.expand = func(address string, options expand.ExpandOptions) ([]string, error) {
+		*calls++
+		return []string{address, address + " expanded"}, nil
+	}
+	c.expandRoot = func(address string, options expand.ExpandOptions) ([]string, error) {
+		*calls++
+		return []string{address + " root"}, nil
+	}
+	return c
+}
+
+func TestCacheHitsAndMisses(t *testing.T) {
+	var calls int
+	c := newTestCache(10, &calls)
+
+	first := c.ParseAddress("franklin ave")
+	second := c.ParseAddress("franklin ave")
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("cached result differs: %v != %v", second, first)
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 call, got %d", calls)
+	}
+
+	// Different options and different functions are cached separately.
+	c.ParseAddressOptions("franklin ave", parser.ParserOptions{Country: "us"})
+	c.ExpandAddress("franklin ave")
+	c.ExpandAddressRoot("franklin ave")
+	c.ExpandAddress("franklin ave")
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got %d", calls)
+	}
+
+	expected := Stats{Hits: 2, Misses: 4, Len: 4}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("stats: %+v != %+v", stats, expected)
+	}
+
+	c.Purge()
+	if stats := c.Stats(); stats != (Stats{}) {
+		t.Errorf("stats after Purge: %+v", stats)
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	var calls int
+	c := newTestCache(2, &calls)
+
+	c.ParseAddress("a")
+	c.ParseAddress("b")
+	c.ParseAddress("a") // b is now least recently used
+	c.ParseAddress("c") // evicts b
+	c.ParseAddress("a")
+	c.ParseAddress("b")
+
+	if calls != 4 {
+		t.Errorf("expected 4 calls, got %d", calls)
+	}
+	expected := Stats{Hits: 2, Misses: 4, Evictions: 2, Len: 2}
+	if stats := c.Stats(); stats != expected {
+		t.Errorf("stats: %+v != %+v", stats, expected)
+	}
+}
+
+func TestCacheDefensiveCopies(t *testing.T) {
+	var calls int
+	c := newTestCache(10, &calls)
+
+	components := c.ParseAddress("franklin ave")
+	components[0].Value = "poisoned"
+	components = c.ParseAddress("franklin ave")
+	components[0].Label = "poisoned"
+
+	if components := c.ParseAddress("franklin ave"); components[0] != (parser.ParsedComponent{Label: "road", Value: "franklin ave"}) {
+		t.Errorf("cache was modified through a returned result: %v", components)
+	}
+
+	expansions := c.ExpandAddress("franklin ave")
+	expansions[0] = "poisoned"
+	if expansions := c.ExpandAddress("franklin ave"); expansions[0] != "franklin ave" {
+		t.Errorf("cache was modified through a returned result: %v", expansions)
+	}
+}
+
+func TestCacheSkipsErrors(t *testing.T) {
+	var calls int
+	c := newTestCache(10, &calls)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.ParseAddressOptionsE("fail", parser.ParserOptions{}); !errors.Is(err, parser.ErrLibpostal) {
+			t.Errorf("expected ErrLibpostal, got %v", err)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected errors not to be cached, got %d calls", calls)
+	}
+}
+
+func TestHashOptions(t *testing.T) {
+	if hashParserOptions(parser.ParserOptions{Language: "en"}) == hashParserOptions(parser.ParserOptions{Country: "en"}) {
+		t.Error("language and country hash the same")
+	}
+
+	options := expand.GetDefaultExpansionOptions()
+	options.Languages = []string{"en"}
+	hash := hashExpandOptions(options)
+
+	// Equal options hash the same even if the slices differ.
+	options.Languages = append([]string(nil), "en")
+	if hashExpandOptions(options) != hash {
+		t.Error("equal options hash differently")
+	}
+
+	options.Languages = []string{"e", "n"}
+	if hashExpandOptions(options) == hash {
+		t.Error("different languages hash the same")
+	}
+
+	options.Languages = []string{"en"}
+	options.RomanNumerals = !options.RomanNumerals
+	if hashExpandOptions(options) == hash {
+		t.Error("different flags hash the same")
+	}
+}
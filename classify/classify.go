@@ -0,0 +1,98 @@
+package postal
+
+/*
+#cgo pkg-config: libpostal
+#include <libpostal/libpostal.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "unicode/utf8"
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/errs"
+    "github.com/openvenues/gopostal/internal/lifecycle"
+)
+
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+)
+
+type Config = lifecycle.Config
+
+var libpostal = lifecycle.NewHandle(lifecycle.Core | lifecycle.LanguageClassifier)
+
+// Setup loads libpostal's core data and language classifier using the
+// directories in config. Calling it is optional; otherwise they are loaded on
+// first use, honoring $GOPOSTAL_DATADIR.
+func Setup(config Config) error {
+    return libpostal.Setup(config)
+}
+
+// Teardown unloads the data files loaded by Setup or on first use, unless
+// another package still uses them.
+func Teardown() {
+    libpostal.Teardown()
+}
+
+// Loaded reports whether the data files the package uses are loaded. They are
+// loaded on first use, and unloaded after Config.IdleTimeout without use.
+func Loaded() bool {
+    return libpostal.Loaded()
+}
+
+type LanguageScore struct {
+    Language string `json:"language"`
+    Probability float64 `json:"probability"`
+}
+
+func ClassifyLanguageE(text string) ([]LanguageScore, error) {
+    if !utf8.ValidString(text) {
+        return nil, ErrInvalidUTF8
+    }
+
+    lifecycle.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
+    }
+
+    cText := C.CString(text)
+    defer C.free(unsafe.Pointer(cText))
+
+    cResponsePtr := C.libpostal_classify_language(cText)
+    if cResponsePtr == nil {
+        return nil, ErrLibpostal
+    }
+    defer C.libpostal_language_classifier_response_destroy(cResponsePtr)
+
+    numLanguages := uint64(cResponsePtr.num_languages)
+
+    scores := make([]LanguageScore, numLanguages)
+    if numLanguages == 0 {
+        return scores, nil
+    }
+
+    // Accessing C arrays
+    cLanguagesPtr := (*[1<<30](*C.char))(unsafe.Pointer(cResponsePtr.languages))[:numLanguages:numLanguages]
+    cProbsPtr := (*[1<<30]C.double)(unsafe.Pointer(cResponsePtr.probs))[:numLanguages:numLanguages]
+
+    var i uint64
+    for i = 0; i < numLanguages; i++ {
+        scores[i] = LanguageScore{
+            Language: C.GoString(cLanguagesPtr[i]),
+            Probability: float64(cProbsPtr[i]),
+        }
+    }
+
+    return scores, nil
+}
+
+func ClassifyLanguage(text string) []LanguageScore {
+    scores, _ := ClassifyLanguageE(text)
+    return scores
+}
@@ -0,0 +1,77 @@
+package postal
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestClassifyLanguage(t *testing.T) {
+	testCases := []struct {
+		name             string
+		input            string
+		expectedLanguage string
+	}{
+		{
+			name:             "English address",
+			input:            "781 Franklin Ave Crown Heights Brooklyn NY 11216 USA",
+			expectedLanguage: "en",
+		},
+		{
+			name:             "French address",
+			input:            "15 Rue de la Paix, 75002 Paris, France",
+			expectedLanguage: "fr",
+		},
+		{
+			name:             "German address",
+			input:            "Unter den Linden 1, 10117 Berlin, Deutschland",
+			expectedLanguage: "de",
+		},
+		{
+			name:             "Russian address",
+			input:            "Тверская улица 1, Москва, Россия",
+			expectedLanguage: "ru",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			scores := ClassifyLanguage(tc.input)
+			if len(scores) == 0 {
+				t.Fatalf("ClassifyLanguage returned empty: %v", scores)
+			}
+
+			if scores[0].Language != tc.expectedLanguage {
+				t.Errorf("ClassifyLanguage returned unexpected top language.\nGot:  %v\nWant: %s", scores, tc.expectedLanguage)
+			}
+
+			for _, score := range scores {
+				if score.Probability <= 0 || score.Probability > 1 {
+					t.Errorf("Probability out of range for %s: %f", score.Language, score.Probability)
+				}
+			}
+		})
+	}
+}
+
+func TestClassifyLanguageInvalidUTF8(t *testing.T) {
+	if scores := ClassifyLanguage("\xff\xfe"); scores != nil {
+		t.Errorf("ClassifyLanguage returned scores for invalid UTF-8: %v", scores)
+	}
+
+	if _, err := ClassifyLanguageE("\xff\xfe"); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("expected ErrInvalidUTF8, got %v", err)
+	}
+}
+
+func TestLanguageScoreJSON(t *testing.T) {
+	marshaledJSON, err := json.Marshal(LanguageScore{Language: "en", Probability: 0.5})
+	if err != nil {
+		t.Fatal("JSON.marshal error: " + err.Error())
+	}
+
+	expectedJSON := `{"language":"en","probability":0.5}`
+	if string(marshaledJSON) != expectedJSON {
+		t.Error("json != expected: ", string(marshaledJSON), "!=", expectedJSON)
+	}
+}
@@ -2,25 +2,53 @@ package postal
 
 /*
 #cgo pkg-config: libpostal
+#cgo CFLAGS: -I${SRCDIR}/../internal/cbuf
 #include <libpostal/libpostal.h>
 #include <stdlib.h>
+#include "cbuf.h"
 
 */
 import "C"
 
 import (
+    "context"
     "unsafe"
-    "log"
-    "sync"
     "unicode/utf8"
+
+    "github.com/openvenues/gopostal/internal/cbuf"
+    "github.com/openvenues/gopostal/internal/cstrings"
+    "github.com/openvenues/gopostal/internal/errs"
+    "github.com/openvenues/gopostal/internal/hooks"
+    "github.com/openvenues/gopostal/internal/lifecycle"
 )
 
-var mu sync.Mutex
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+)
 
-func init() {
-    if (!bool(C.libpostal_setup()) || !bool(C.libpostal_setup_language_classifier())) {
-        log.Fatal("Could not load libpostal")
-    }
+type Config = lifecycle.Config
+
+var libpostal = lifecycle.NewHandle(lifecycle.Core | lifecycle.LanguageClassifier)
+
+// Setup loads libpostal's core data and language classifier using the
+// directories in config. Calling it is optional; otherwise they are loaded on
+// first use, honoring $GOPOSTAL_DATADIR.
+func Setup(config Config) error {
+    return libpostal.Setup(config)
+}
+
+// Teardown unloads the data files loaded by Setup or on first use, unless
+// another package still uses them.
+func Teardown() {
+    libpostal.Teardown()
+}
+
+// Loaded reports whether the data files the package uses are loaded. They are
+// loaded on first use, and unloaded after Config.IdleTimeout without use.
+func Loaded() bool {
+    return libpostal.Loaded()
 }
 
 const (
@@ -91,38 +119,14 @@ func GetDefaultExpansionOptions() ExpandOptions {
 
 var libpostalDefaultOptions = GetDefaultExpansionOptions()
 
-func ExpandAddressOptions(address string, options ExpandOptions) []string {
-    if !utf8.ValidString(address) {
-        return nil
-    }
-
-    mu.Lock()
-    defer mu.Unlock()
-
-    cAddress := C.CString(address)
-    defer C.free(unsafe.Pointer(cAddress))
-
-    var char_ptr *C.char
-    ptr_size := unsafe.Sizeof(char_ptr)
+// cExpandOptions converts options to libpostal's C struct. The returned
+// languages array is referenced by the struct and must be freed by the caller.
+func cExpandOptions(options ExpandOptions) (C.libpostal_normalize_options_t, *cstrings.Array) {
+    cLanguages := cstrings.NewArray(options.Languages)
 
     cOptions := C.libpostal_get_default_options()
-    if options.Languages != nil {
-        cLanguages := C.calloc(C.size_t(len(options.Languages)), C.size_t(ptr_size))
-        cLanguagesPtr := (*[1<<30](*C.char))(unsafe.Pointer(cLanguages))
-
-        defer C.free(unsafe.Pointer(cLanguages))
-
-        for i := 0; i < len(options.Languages); i++ {
-            cLang := C.CString(options.Languages[i])
-            defer C.free(unsafe.Pointer(cLang))
-            cLanguagesPtr[i] = cLang
-        }
-
-        cOptions.languages = (**C.char)(cLanguages)
-        cOptions.num_languages = C.size_t(len(options.Languages))
-    } else {
-        cOptions.num_languages = 0
-    }
+    cOptions.languages = (**C.char)(cLanguages.Pointer())
+    cOptions.num_languages = C.size_t(cLanguages.Len())
 
     cOptions.address_components = C.uint16_t(options.AddressComponents)
     cOptions.latin_ascii = C.bool(options.LatinAscii)
@@ -143,23 +147,82 @@ func ExpandAddressOptions(address string, options ExpandOptions) []string {
     cOptions.expand_numex = C.bool(options.ExpandNumex)
     cOptions.roman_numerals = C.bool(options.RomanNumerals)
 
-    var cNumExpansions = C.size_t(0)
+    return cOptions, cLanguages
+}
+
+// expandAddress runs libpostal's expansion on a single address. The caller
+// must hold the lock and have loaded libpostal.
+func expandAddress(address string, cOptions C.libpostal_normalize_options_t, root bool) ([]string, error) {
+    cAddress := C.CString(address)
+    defer C.free(unsafe.Pointer(cAddress))
+
+    // The expansions come back in one buffer, which is read in place and
+    // copied into Go without the lengths in one allocation.
+    var cSize C.size_t
+    cBuf := C.cbuf_expand_address(cAddress, cOptions, C.bool(root), &cSize)
+    if cBuf == nil {
+        return nil, ErrLibpostal
+    }
+    defer C.free(unsafe.Pointer(cBuf))
+
+    r, n, err := cbuf.NewReader(unsafe.String((*byte)(unsafe.Pointer(cBuf)), int(cSize)))
+    if err != nil {
+        return nil, err
+    }
 
-    cExpansions := C.libpostal_expand_address(cAddress, cOptions, &cNumExpansions)
+    expansions := make([]string, n)
+    for i := range expansions {
+        if expansions[i], err = r.Next(); err != nil {
+            return nil, err
+        }
+    }
+    cbuf.Clone(n, func(i int) *string {
+        return &expansions[i]
+    })
 
-    numExpansions := uint64(cNumExpansions)
+    return expansions, nil
+}
 
-    var expansions = make([]string, numExpansions)
+func expandAddressOptions(ctx context.Context, address string, options ExpandOptions, root bool) (expansions []string, err error) {
+    op := "expand.ExpandAddress"
+    if root {
+        op = "expand.ExpandAddressRoot"
+    }
+    call := hooks.Start(op, len(address))
+    defer func() { call.Done(len(expansions), err) }()
+
+    if !utf8.ValidString(address) {
+        return nil, ErrInvalidUTF8
+    }
 
-    // Accessing a C array
-    cExpansionsPtr := (*[1<<30](*C.char))(unsafe.Pointer(cExpansions))
+    cOptions, cLanguages := cExpandOptions(options)
+    defer cLanguages.Free()
 
-    var i uint64
-    for i = 0; i < numExpansions; i++ {
-        expansions[i] = C.GoString(cExpansionsPtr[i])
+    if err := call.LockContext(ctx); err != nil {
+        return nil, err
     }
+    defer lifecycle.Unlock()
 
-    C.libpostal_expansion_array_destroy(cExpansions, cNumExpansions)
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
+    }
+
+    return expandAddress(address, cOptions, root)
+}
+
+// ExpandAddressContext is ExpandAddressOptionsE, but gives up waiting for
+// other calls into libpostal and returns ctx.Err() if ctx is done first. Once
+// libpostal starts expanding, it runs to completion.
+func ExpandAddressContext(ctx context.Context, address string, options ExpandOptions) ([]string, error) {
+    return expandAddressOptions(ctx, address, options, false)
+}
+
+func ExpandAddressOptionsE(address string, options ExpandOptions) ([]string, error) {
+    return expandAddressOptions(context.Background(), address, options, false)
+}
+
+func ExpandAddressOptions(address string, options ExpandOptions) []string {
+    expansions, _ := ExpandAddressOptionsE(address, options)
     return expansions
 }
 
@@ -167,3 +230,72 @@ func ExpandAddress(address string) []string {
     return ExpandAddressOptions(address, libpostalDefaultOptions)
 }
 
+func ExpandAddressRootOptionsE(address string, options ExpandOptions) ([]string, error) {
+    return expandAddressOptions(context.Background(), address, options, true)
+}
+
+func ExpandAddressRootOptions(address string, options ExpandOptions) []string {
+    expansions, _ := ExpandAddressRootOptionsE(address, options)
+    return expansions
+}
+
+func ExpandAddressRoot(address string) []string {
+    return ExpandAddressRootOptions(address, libpostalDefaultOptions)
+}
+
+// Number of addresses ExpandAddresses expands per acquisition of the lock, so
+// that large batches don't starve other callers.
+const expandBatchSize = 256
+
+// ExpandAddresses expands each of addresses with the same options, converting
+// options to C only once. The error for addresses[i] is in the second slice at
+// index i, and is nil on success.
+func ExpandAddresses(addresses []string, options ExpandOptions) ([][]string, []error) {
+    results := make([][]string, len(addresses))
+    expandErrors := make([]error, len(addresses))
+
+    cOptions, cLanguages := cExpandOptions(options)
+    defer cLanguages.Free()
+
+    for start := 0; start < len(addresses); start += expandBatchSize {
+        end := start + expandBatchSize
+        if end > len(addresses) {
+            end = len(addresses)
+        }
+
+        expandBatch(addresses[start:end], cOptions, results[start:end], expandErrors[start:end])
+    }
+
+    return results, expandErrors
+}
+
+func expandBatch(addresses []string, cOptions C.libpostal_normalize_options_t, results [][]string, expandErrors []error) {
+    var inputLen, numResults int
+    var err error
+    for _, address := range addresses {
+        inputLen += len(address)
+    }
+
+    call := hooks.Start("expand.ExpandAddresses", inputLen)
+    defer func() { call.Done(numResults, err) }()
+
+    call.Lock()
+    defer lifecycle.Unlock()
+
+    if err = libpostal.Ensure(); err != nil {
+        for i := range expandErrors {
+            expandErrors[i] = err
+        }
+        return
+    }
+
+    for i, address := range addresses {
+        if !utf8.ValidString(address) {
+            expandErrors[i] = ErrInvalidUTF8
+            continue
+        }
+
+        results[i], expandErrors[i] = expandAddress(address, cOptions, false)
+        numResults += len(results[i])
+    }
+}
@@ -1,6 +1,14 @@
 package postal
 
-import "testing"
+import (
+    "context"
+    "errors"
+    "reflect"
+    "testing"
+    "time"
+
+    "github.com/openvenues/gopostal/internal/lifecycle"
+)
 
 func testExpansionInOutput(t *testing.T, address string, output string, expansions []string) {
     for i := 0; i < len(expansions); i++ {
@@ -23,6 +31,25 @@ func testExpansionWithOptions(t *testing.T, address string, output string, optio
     testExpansionInOutput(t, address, output, expansions)
 }
 
+func testExpansionNotInOutput(t *testing.T, address string, output string, expansions []string) {
+    for i := 0; i < len(expansions); i++ {
+        if expansions[i] == output {
+            t.Error("expansion", output, "unexpectedly found in expansions for address", address)
+            return
+        }
+    }
+}
+
+func testRootExpansion(t *testing.T, address string, output string) {
+    expansions := ExpandAddressRoot(address)
+    testExpansionInOutput(t, address, output, expansions)
+}
+
+func testRootExpansionWithOptions(t *testing.T, address string, output string, options ExpandOptions) {
+    expansions := ExpandAddressRootOptions(address, options)
+    testExpansionInOutput(t, address, output, expansions)
+}
+
 
 func TestEnglishExpansions(t *testing.T) {
     testExpansion(t, "123 Main St", "123 main street")
@@ -35,6 +62,18 @@ func TestEnglishExpansions(t *testing.T) {
 
 }
 
+func TestEnglishRootExpansions(t *testing.T) {
+    testExpansion(t, "Main St", "main street")
+    testRootExpansion(t, "Main St", "main")
+    testExpansionNotInOutput(t, "Main St", "main street", ExpandAddressRoot("Main St"))
+
+    englishOptions := GetDefaultExpansionOptions()
+    englishOptions.Languages = []string{"en"}
+
+    testRootExpansionWithOptions(t, "N Main St", "main", englishOptions)
+    testRootExpansionWithOptions(t, "123 Main St", "123 main", englishOptions)
+}
+
 
 func TestMultilingualExpansions(t *testing.T) {
     multilingualOptions := GetDefaultExpansionOptions()
@@ -49,3 +88,118 @@ func TestMultilingualExpansions(t *testing.T) {
 func TestNonASCIIExpansions(t *testing.T) {
     testExpansion(t, "Friedrichstraße 128, Berlin, Germany", "friedrich strasse 128 berlin germany")
 }
+
+func TestExpansionErrors(t *testing.T) {
+    expansions, err := ExpandAddressOptionsE("123 Main St \xff", GetDefaultExpansionOptions())
+    if !errors.Is(err, ErrInvalidUTF8) {
+        t.Error("expected ErrInvalidUTF8, got: ", err)
+    }
+    if expansions != nil {
+        t.Error("expected nil expansions, got: ", expansions)
+    }
+
+    if _, err := ExpandAddressRootOptionsE("\xff", GetDefaultExpansionOptions()); !errors.Is(err, ErrInvalidUTF8) {
+        t.Error("expected ErrInvalidUTF8, got: ", err)
+    }
+
+    if _, err := ExpandAddressOptionsE("123 Main St", GetDefaultExpansionOptions()); err != nil {
+        t.Error("unexpected error: " + err.Error())
+    }
+}
+
+func TestExpandAddressContext(t *testing.T) {
+    lifecycle.Lock()
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+    defer cancel()
+    _, err := ExpandAddressContext(ctx, "123 Main St", GetDefaultExpansionOptions())
+    lifecycle.Unlock()
+
+    if !errors.Is(err, context.DeadlineExceeded) {
+        t.Error("expected context.DeadlineExceeded, got: ", err)
+    }
+
+    if _, err := ExpandAddressContext(context.Background(), "123 Main St", GetDefaultExpansionOptions()); err != nil {
+        t.Error("unexpected error: " + err.Error())
+    }
+}
+
+func TestExpandAddresses(t *testing.T) {
+    englishOptions := GetDefaultExpansionOptions()
+    englishOptions.Languages = []string{"en"}
+
+    addresses := []string{"123 Main St", "\xff", "30 West Twenty-sixth St Fl No. 7"}
+
+    results, expandErrors := ExpandAddresses(addresses, englishOptions)
+    if len(results) != len(addresses) || len(expandErrors) != len(addresses) {
+        t.Fatalf("expected %d results and errors, got %d and %d", len(addresses), len(results), len(expandErrors))
+    }
+
+    for i, address := range addresses {
+        expected, expectedErr := ExpandAddressOptionsE(address, englishOptions)
+
+        if !errors.Is(expandErrors[i], expectedErr) {
+            t.Errorf("address %d: error %v != expected %v", i, expandErrors[i], expectedErr)
+        }
+
+        if !reflect.DeepEqual(results[i], expected) {
+            t.Errorf("address %d: expansions != expected: %v != %v", i, results[i], expected)
+        }
+    }
+
+    testExpansionInOutput(t, addresses[0], "123 main street", results[0])
+    testExpansionInOutput(t, addresses[2], "30 west 26th street floor number 7", results[2])
+
+    if !errors.Is(expandErrors[1], ErrInvalidUTF8) {
+        t.Error("expected ErrInvalidUTF8 for invalid input, got: ", expandErrors[1])
+    }
+}
+
+var benchmarkAddresses = []string{
+    "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA",
+    "30 West Twenty-sixth St Fl No. 7, New York, NY 10010",
+    "Friedrichstraße 128, 10117 Berlin, Germany",
+    "Quatre-vingt-douze Ave des Champs-Élysées",
+}
+
+func benchmarkBatch(n int) []string {
+    addresses := make([]string, n)
+    for i := range addresses {
+        addresses[i] = benchmarkAddresses[i%len(benchmarkAddresses)]
+    }
+    return addresses
+}
+
+func BenchmarkExpandAddress(b *testing.B) {
+    address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+    b.ReportAllocs()
+
+    for i := 0; i < b.N; i++ {
+        ExpandAddress(address)
+    }
+}
+
+func BenchmarkExpandAddressLoop(b *testing.B) {
+    addresses := benchmarkBatch(1000)
+    options := GetDefaultExpansionOptions()
+    options.Languages = []string{"en", "fr", "de"}
+    b.ReportAllocs()
+    b.ResetTimer()
+
+    for i := 0; i < b.N; i++ {
+        for _, address := range addresses {
+            ExpandAddressOptions(address, options)
+        }
+    }
+}
+
+func BenchmarkExpandAddresses(b *testing.B) {
+    addresses := benchmarkBatch(1000)
+    options := GetDefaultExpansionOptions()
+    options.Languages = []string{"en", "fr", "de"}
+    b.ReportAllocs()
+    b.ResetTimer()
+
+    for i := 0; i < b.N; i++ {
+        ExpandAddresses(addresses, options)
+    }
+}
@@ -0,0 +1,85 @@
+package postal
+
+import (
+    "fmt"
+    "strings"
+)
+
+type abbreviation struct {
+    word string
+    abbr string
+    // suffix rules abbreviate a word ending, as in "Friedrichstraße".
+    suffix bool
+}
+
+func parseAbbreviations(s string) ([]abbreviation, error) {
+    var rules []abbreviation
+
+    for _, line := range strings.Split(s, "\n") {
+        line = strings.TrimSpace(line)
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        parts := strings.Split(line, "=")
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("invalid abbreviation %q", line)
+        }
+        word, abbr := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+        suffix := strings.HasPrefix(word, "-")
+        if suffix != strings.HasPrefix(abbr, "-") {
+            return nil, fmt.Errorf("invalid abbreviation %q", line)
+        }
+        if suffix {
+            word, abbr = word[1:], abbr[1:]
+        }
+        if word == "" || abbr == "" {
+            return nil, fmt.Errorf("invalid abbreviation %q", line)
+        }
+
+        rules = append(rules, abbreviation{strings.ToLower(word), abbr, suffix})
+    }
+
+    return rules, nil
+}
+
+// abbreviate applies the first matching rule to each word of value. Words are
+// matched case-insensitively, and an all-lowercase or all-uppercase word keeps
+// its case.
+func abbreviate(value string, rules []abbreviation) string {
+    if len(rules) == 0 {
+        return value
+    }
+
+    words := strings.Fields(value)
+    for i, word := range words {
+        lower := strings.ToLower(word)
+
+        for _, rule := range rules {
+            if !rule.suffix && lower == rule.word {
+                words[i] = matchCase(word, rule.abbr)
+                break
+            }
+            // Only where lowercasing kept the byte offsets, and not for the
+            // whole word, which a plain rule covers.
+            if rule.suffix && len(lower) == len(word) && len(lower) > len(rule.word) && strings.HasSuffix(lower, rule.word) {
+                cut := len(word) - len(rule.word)
+                words[i] = word[:cut] + matchCase(word[cut:], rule.abbr)
+                break
+            }
+        }
+    }
+
+    return strings.Join(words, " ")
+}
+
+func matchCase(word string, abbr string) string {
+    switch {
+    case word == strings.ToLower(word):
+        return strings.ToLower(abbr)
+    case word == strings.ToUpper(word):
+        return strings.ToUpper(abbr)
+    }
+    return abbr
+}
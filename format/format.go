@@ -0,0 +1,247 @@
+package postal
+
+import (
+    "embed"
+    "fmt"
+    "path"
+    "strings"
+    "unicode/utf8"
+
+    "github.com/openvenues/gopostal/internal/errs"
+    label "github.com/openvenues/gopostal/label"
+)
+
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrEmptyInput = errs.ErrEmptyInput
+    ErrInvalidLabel = errs.ErrInvalidLabel
+)
+
+// Per-country templates, named by lowercase ISO 3166-1 alpha-2 code, and
+// per-language abbreviations, named by ISO 639-1 code.
+//
+//go:embed templates/*.txt abbreviations/*.txt
+var files embed.FS
+
+// Countries that format like another country with a template.
+var useCountry = map[string]string{
+    "ca": "us",
+    "pr": "us",
+    "at": "de",
+    "ch": "de",
+    "nl": "de",
+    "be": "de",
+    "dk": "de",
+    "no": "de",
+    "se": "de",
+    "lu": "fr",
+    "mc": "fr",
+    "ie": "gb",
+    "nz": "au",
+    "mx": "es",
+    "pt": "es",
+    "ar": "es",
+    "tw": "cn",
+}
+
+// Languages whose abbreviations are used for each country.
+var countryLanguages = map[string]string{
+    "us": "en",
+    "ca": "en",
+    "pr": "en",
+    "gb": "en",
+    "ie": "en",
+    "au": "en",
+    "nz": "en",
+    "de": "de",
+    "at": "de",
+    "ch": "de",
+    "fr": "fr",
+    "lu": "fr",
+    "mc": "fr",
+    "es": "es",
+    "mx": "es",
+    "ar": "es",
+    "nl": "nl",
+    "be": "nl",
+    "br": "pt",
+    "pt": "pt",
+    "it": "it",
+}
+
+// Components whose words are abbreviated with FormatOptions.Abbreviate.
+var abbreviatedLabels = map[label.Label]bool{
+    label.Road: true,
+    label.Unit: true,
+    label.Level: true,
+    label.Staircase: true,
+    label.Entrance: true,
+    label.PoBox: true,
+}
+
+const defaultTemplate = "default"
+
+var (
+    templates = mustLoadTemplates()
+    abbreviations = mustLoadAbbreviations()
+)
+
+func mustLoadTemplates() map[string][]node {
+    entries, err := files.ReadDir("templates")
+    if err != nil {
+        panic(err)
+    }
+
+    templates := make(map[string][]node, len(entries))
+    for _, entry := range entries {
+        data, err := files.ReadFile(path.Join("templates", entry.Name()))
+        if err != nil {
+            panic(err)
+        }
+        nodes, err := parseTemplate(string(data))
+        if err != nil {
+            panic(fmt.Sprintf("%s: %v", entry.Name(), err))
+        }
+        templates[strings.TrimSuffix(entry.Name(), ".txt")] = nodes
+    }
+    return templates
+}
+
+func mustLoadAbbreviations() map[string][]abbreviation {
+    entries, err := files.ReadDir("abbreviations")
+    if err != nil {
+        panic(err)
+    }
+
+    abbreviations := make(map[string][]abbreviation, len(entries))
+    for _, entry := range entries {
+        data, err := files.ReadFile(path.Join("abbreviations", entry.Name()))
+        if err != nil {
+            panic(err)
+        }
+        rules, err := parseAbbreviations(string(data))
+        if err != nil {
+            panic(fmt.Sprintf("%s: %v", entry.Name(), err))
+        }
+        abbreviations[strings.TrimSuffix(entry.Name(), ".txt")] = rules
+    }
+    return abbreviations
+}
+
+type FormatOptions struct {
+    // Abbreviate common words in the road, unit and similar components,
+    // e.g. "Avenue" to "Ave", in the country's language.
+    Abbreviate bool
+    // Uppercase the whole address, as some postal services prefer.
+    Uppercase bool
+    // SingleLine joins the lines with ", " instead of newlines.
+    SingleLine bool
+}
+
+func GetDefaultFormatOptions() FormatOptions {
+    return FormatOptions{}
+}
+
+// FormatAddressOptionsE renders components as a postal address laid out for
+// country, an ISO 3166-1 alpha-2 code, e.g. with the postcode before the city
+// in Germany. Countries without a template use a generic layout. Values are
+// used as given, so pass the Original of parser.ParseAddressSpans to keep the input's
+// case. Values of repeated labels are joined by spaces, and components the
+// template doesn't use, such as "category" and "near", are left out.
+func FormatAddressOptionsE(components []label.Component, country string, options FormatOptions) (string, error) {
+    if len(components) == 0 {
+        return "", ErrEmptyInput
+    }
+
+    country = strings.ToLower(strings.TrimSpace(country))
+
+    values := make(map[label.Label]string, len(components))
+    for _, component := range components {
+        if !utf8.ValidString(component.Value) {
+            return "", ErrInvalidUTF8
+        }
+        if !component.Label.IsValid() {
+            return "", label.Validate([]string{string(component.Label)})
+        }
+
+        value := strings.Join(strings.Fields(component.Value), " ")
+        if value == "" {
+            continue
+        }
+        if options.Abbreviate && abbreviatedLabels[component.Label] {
+            value = abbreviate(value, abbreviations[countryLanguages[country]])
+        }
+
+        if existing := values[component.Label]; existing != "" {
+            value = existing + " " + value
+        }
+        values[component.Label] = value
+    }
+
+    var b strings.Builder
+    renderNodes(templateFor(country), values, &b)
+
+    lines := cleanLines(b.String())
+    if len(lines) == 0 {
+        return "", ErrEmptyInput
+    }
+
+    separator := "\n"
+    if options.SingleLine {
+        separator = ", "
+    }
+    formatted := strings.Join(lines, separator)
+
+    if options.Uppercase {
+        formatted = upper(formatted)
+    }
+    return formatted, nil
+}
+
+func FormatAddressOptions(components []label.Component, country string, options FormatOptions) string {
+    formatted, _ := FormatAddressOptionsE(components, country, options)
+    return formatted
+}
+
+func FormatAddress(components []label.Component, country string) string {
+    return FormatAddressOptions(components, country, GetDefaultFormatOptions())
+}
+
+// upper uppercases s, including "ß", which has no single uppercase letter in
+// common use and is written "SS".
+func upper(s string) string {
+    return strings.ToUpper(strings.ReplaceAll(s, "ß", "ss"))
+}
+
+func templateFor(country string) []node {
+    if other, ok := useCountry[country]; ok {
+        country = other
+    }
+    if nodes, ok := templates[country]; ok {
+        return nodes
+    }
+    return templates[defaultTemplate]
+}
+
+// cleanLines tidies rendered output, in which empty components leave behind
+// extra spaces, dangling separators and empty lines.
+func cleanLines(s string) []string {
+    var lines []string
+
+    for _, line := range strings.Split(s, "\n") {
+        line = strings.Join(strings.Fields(line), " ")
+        line = strings.ReplaceAll(line, " ,", ",")
+        for strings.Contains(line, ",,") {
+            line = strings.ReplaceAll(line, ",,", ",")
+        }
+        line = strings.Trim(line, " ,-")
+
+        // e.g. a city that is also its own state, as in Berlin or Singapore.
+        if line == "" || (len(lines) > 0 && lines[len(lines)-1] == line) {
+            continue
+        }
+        lines = append(lines, line)
+    }
+
+    return lines
+}
@@ -0,0 +1,230 @@
+package postal
+
+import (
+	"errors"
+	"testing"
+
+	label "github.com/openvenues/gopostal/label"
+)
+
+func TestFormatAddress(t *testing.T) {
+	testCases := []struct {
+		name       string
+		components []label.Component
+		country    string
+		expected   string
+	}{
+		{
+			"US",
+			[]label.Component{
+				{Label: "house_number", Value: "781"},
+				{Label: "road", Value: "Franklin Ave"},
+				{Label: "suburb", Value: "Crown Heights"},
+				{Label: "city", Value: "Brooklyn"},
+				{Label: "state", Value: "NY"},
+				{Label: "postcode", Value: "11216"},
+				{Label: "country", Value: "USA"},
+			},
+			"US",
+			"781 Franklin Ave\nCrown Heights\nBrooklyn, NY 11216\nUSA",
+		},
+		{
+			"US without city",
+			[]label.Component{
+				{Label: "house_number", Value: "781"},
+				{Label: "road", Value: "Franklin Ave"},
+				{Label: "state", Value: "NY"},
+				{Label: "postcode", Value: "11216"},
+			},
+			"us",
+			"781 Franklin Ave\nNY 11216",
+		},
+		{
+			"Germany",
+			[]label.Component{
+				{Label: "road", Value: "Friedrichstraße"},
+				{Label: "house_number", Value: "128"},
+				{Label: "postcode", Value: "10117"},
+				{Label: "city", Value: "Berlin"},
+				{Label: "state", Value: "Berlin"},
+				{Label: "country", Value: "Deutschland"},
+			},
+			"de",
+			"Friedrichstraße 128\n10117 Berlin\nDeutschland",
+		},
+		{
+			"Austria uses the German template",
+			[]label.Component{
+				{Label: "road", Value: "Stephansplatz"},
+				{Label: "house_number", Value: "1"},
+				{Label: "postcode", Value: "1010"},
+				{Label: "city", Value: "Wien"},
+			},
+			"at",
+			"Stephansplatz 1\n1010 Wien",
+		},
+		{
+			"Japan",
+			[]label.Component{
+				{Label: "house_number", Value: "21-1"},
+				{Label: "suburb", Value: "渋谷2丁目"},
+				{Label: "city", Value: "渋谷区"},
+				{Label: "state", Value: "東京都"},
+				{Label: "postcode", Value: "150-0002"},
+			},
+			"jp",
+			"〒150-0002\n東京都渋谷区渋谷2丁目21-1",
+		},
+		{
+			"Japan without postcode",
+			[]label.Component{
+				{Label: "city", Value: "渋谷区"},
+				{Label: "state", Value: "東京都"},
+			},
+			"jp",
+			"東京都渋谷区",
+		},
+		{
+			"Unknown country",
+			[]label.Component{
+				{Label: "house", Value: "Science Park"},
+				{Label: "road", Value: "Vasagatan"},
+				{Label: "house_number", Value: "7"},
+				{Label: "postcode", Value: "111 20"},
+				{Label: "city", Value: "Stockholm"},
+				{Label: "category", Value: "park"},
+			},
+			"xx",
+			"Science Park\nVasagatan 7\n111 20 Stockholm",
+		},
+		{
+			"Repeated labels",
+			[]label.Component{
+				{Label: "house_number", Value: "10"},
+				{Label: "road", Value: "Grand Army"},
+				{Label: "road", Value: "Plaza"},
+				{Label: "city", Value: "Brooklyn"},
+			},
+			"us",
+			"10 Grand Army Plaza\nBrooklyn",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			formatted, err := FormatAddressOptionsE(tc.components, tc.country, GetDefaultFormatOptions())
+			if err != nil {
+				t.Fatal("unexpected error: " + err.Error())
+			}
+			if formatted != tc.expected {
+				t.Errorf("formatted != expected:\n%q\n%q", formatted, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatOptions(t *testing.T) {
+	us := []label.Component{
+		{Label: "house_number", Value: "30"},
+		{Label: "road", Value: "West 26th Street"},
+		{Label: "unit", Value: "Suite 7"},
+		{Label: "city", Value: "New York"},
+		{Label: "state", Value: "NY"},
+		{Label: "postcode", Value: "10010"},
+	}
+	de := []label.Component{
+		{Label: "road", Value: "friedrichstraße"},
+		{Label: "house_number", Value: "128"},
+		{Label: "postcode", Value: "10117"},
+		{Label: "city", Value: "berlin"},
+	}
+
+	testCases := []struct {
+		name       string
+		components []label.Component
+		country    string
+		options    FormatOptions
+		expected   string
+	}{
+		{"Abbreviate", us, "us", FormatOptions{Abbreviate: true}, "30 W 26th St\nSte 7\nNew York, NY 10010"},
+		{"Uppercase", us, "us", FormatOptions{Uppercase: true}, "30 WEST 26TH STREET\nSUITE 7\nNEW YORK, NY 10010"},
+		{"Single line", us, "us", FormatOptions{SingleLine: true}, "30 West 26th Street, Suite 7, New York, NY 10010"},
+		{"All", us, "us", FormatOptions{Abbreviate: true, Uppercase: true, SingleLine: true}, "30 W 26TH ST, STE 7, NEW YORK, NY 10010"},
+		{"Abbreviate suffix", de, "de", FormatOptions{Abbreviate: true}, "friedrichstr. 128\n10117 berlin"},
+		{"Uppercase sharp s", de, "de", FormatOptions{Uppercase: true}, "FRIEDRICHSTRASSE 128\n10117 BERLIN"},
+		{"No abbreviations for country", us, "se", FormatOptions{Abbreviate: true}, "West 26th Street 30\nSuite 7\n10010 New York"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if formatted := FormatAddressOptions(tc.components, tc.country, tc.options); formatted != tc.expected {
+				t.Errorf("formatted != expected:\n%q\n%q", formatted, tc.expected)
+			}
+		})
+	}
+}
+
+func TestFormatAddressErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		components  []label.Component
+		expectedErr error
+	}{
+		{"Empty input", nil, ErrEmptyInput},
+		{"Only unused labels", []label.Component{{Label: "near", Value: "prospect park"}}, ErrEmptyInput},
+		{"Invalid UTF-8", []label.Component{{Label: "road", Value: "Main St \xff"}}, ErrInvalidUTF8},
+		{"Invalid label", []label.Component{{Label: "street", Value: "Main St"}}, ErrInvalidLabel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			formatted, err := FormatAddressOptionsE(tc.components, "us", GetDefaultFormatOptions())
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if formatted != "" {
+				t.Errorf("expected empty output, got %q", formatted)
+			}
+		})
+	}
+}
+
+func TestParseTemplate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		template string
+		valid    bool
+	}{
+		{"Text", "Postfach", true},
+		{"Variable", "{{{ road }}} {{{house_number}}}", true},
+		{"First", "{{#first}} {{{city}}} || {{{suburb}}} {{/first}}", true},
+		{"Unterminated variable", "{{{road}}", false},
+		{"Unknown label", "{{{street}}}", false},
+		{"Unterminated first", "{{#first}} {{{city}}}", false},
+		{"Nested first", "{{#first}} {{#first}} {{{city}}} {{/first}} {{/first}}", false},
+		{"Unknown tag", "{{road}}", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseTemplate(tc.template)
+			if tc.valid && err != nil {
+				t.Error("unexpected error: " + err.Error())
+			}
+			if !tc.valid && !errors.Is(err, errTemplate) {
+				t.Errorf("expected %v, got %v", errTemplate, err)
+			}
+		})
+	}
+
+	for country, other := range useCountry {
+		if _, ok := templates[other]; !ok {
+			t.Errorf("%s uses missing template %s", country, other)
+		}
+	}
+	for country, language := range countryLanguages {
+		if _, ok := abbreviations[language]; !ok {
+			t.Errorf("%s uses missing abbreviations %s", country, language)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package postal
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+
+    label "github.com/openvenues/gopostal/label"
+)
+
+// Templates are a small subset of mustache, as used by OpenCage's
+// address-formatting templates:
+//
+//     {{{road}}}                          the value of the road component
+//     {{#first}} a || b || c {{/first}}   the first of a, b and c that uses
+//                                         at least one non-empty component
+//
+// Anything else is copied as is.
+
+var errTemplate = errors.New("postal: invalid address template")
+
+type node interface {
+    // render writes the node and reports whether it used a non-empty value.
+    render(values map[label.Label]string, b *strings.Builder) bool
+}
+
+type text string
+
+func (t text) render(values map[label.Label]string, b *strings.Builder) bool {
+    b.WriteString(string(t))
+    return false
+}
+
+type variable label.Label
+
+func (v variable) render(values map[label.Label]string, b *strings.Builder) bool {
+    value := values[label.Label(v)]
+    b.WriteString(value)
+    return value != ""
+}
+
+type first [][]node
+
+func (f first) render(values map[label.Label]string, b *strings.Builder) bool {
+    for _, alternative := range f {
+        var out strings.Builder
+        if renderNodes(alternative, values, &out) {
+            b.WriteString(strings.TrimSpace(out.String()))
+            return true
+        }
+    }
+    return false
+}
+
+func renderNodes(nodes []node, values map[label.Label]string, b *strings.Builder) bool {
+    used := false
+    for _, n := range nodes {
+        if n.render(values, b) {
+            used = true
+        }
+    }
+    return used
+}
+
+const (
+    firstStart = "{{#first}}"
+    firstEnd = "{{/first}}"
+)
+
+func parseTemplate(s string) ([]node, error) {
+    return parseNodes(s, true)
+}
+
+func parseNodes(s string, allowFirst bool) ([]node, error) {
+    var nodes []node
+
+    for s != "" {
+        i := strings.Index(s, "{{")
+        if i < 0 {
+            nodes = append(nodes, text(s))
+            break
+        }
+        if i > 0 {
+            nodes = append(nodes, text(s[:i]))
+            s = s[i:]
+        }
+
+        switch {
+        case strings.HasPrefix(s, "{{{"):
+            end := strings.Index(s, "}}}")
+            if end < 0 {
+                return nil, fmt.Errorf("%w: unterminated %q", errTemplate, s)
+            }
+            l := label.Label(strings.TrimSpace(s[3:end]))
+            if !l.IsValid() {
+                return nil, fmt.Errorf("%w: unknown label %q", errTemplate, l)
+            }
+            nodes = append(nodes, variable(l))
+            s = s[end+3:]
+
+        case strings.HasPrefix(s, firstStart):
+            if !allowFirst {
+                return nil, fmt.Errorf("%w: nested %s", errTemplate, firstStart)
+            }
+            end := strings.Index(s, firstEnd)
+            if end < 0 {
+                return nil, fmt.Errorf("%w: %s without %s", errTemplate, firstStart, firstEnd)
+            }
+
+            var f first
+            for _, alternative := range strings.Split(s[len(firstStart):end], "||") {
+                alternativeNodes, err := parseNodes(alternative, false)
+                if err != nil {
+                    return nil, err
+                }
+                f = append(f, alternativeNodes)
+            }
+            nodes = append(nodes, f)
+            s = s[end+len(firstEnd):]
+
+        default:
+            end := strings.Index(s, "}}")
+            if end < 0 {
+                end = len(s) - 2
+            }
+            return nil, fmt.Errorf("%w: unknown tag %q", errTemplate, s[:end+2])
+        }
+    }
+
+    return nodes, nil
+}
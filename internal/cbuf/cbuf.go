@@ -0,0 +1,72 @@
+// Package cbuf reads the buffers written by the C helpers in cbuf.h, which
+// the cgo packages include with
+//
+//     #cgo CFLAGS: -I${SRCDIR}/../internal/cbuf
+//     #include "cbuf.h"
+package cbuf
+
+import (
+    "encoding/binary"
+    "errors"
+    "strings"
+)
+
+var ErrMalformed = errors.New("postal: malformed result buffer")
+
+// Reader returns the strings in a buffer in order. They are substrings of
+// the buffer and share its memory, so for a buffer read in place from C, they
+// must be copied with Clone before it is freed.
+type Reader struct {
+    buf string
+}
+
+// NewReader returns a reader for buf along with the number of strings in it.
+func NewReader(buf string) (Reader, int, error) {
+    if len(buf) < 4 {
+        return Reader{}, 0, ErrMalformed
+    }
+    n := binary.NativeEndian.Uint32([]byte(buf[:4]))
+    // Every string takes at least its 4-byte length.
+    if uint64(n) > uint64(len(buf)-4)/4 {
+        return Reader{}, 0, ErrMalformed
+    }
+    return Reader{buf: buf[4:]}, int(n), nil
+}
+
+func (r *Reader) Next() (string, error) {
+    if len(r.buf) < 4 {
+        return "", ErrMalformed
+    }
+    n := binary.NativeEndian.Uint32([]byte(r.buf[:4]))
+    if uint64(len(r.buf)-4) < uint64(n) {
+        return "", ErrMalformed
+    }
+
+    s := r.buf[4:4+n]
+    r.buf = r.buf[4+n:]
+    return s, nil
+}
+
+// Clone copies n strings into one Go allocation and replaces each with its
+// substring of the copy. str returns a pointer to the i-th string. Unlike
+// copying the whole buffer, this leaves out the lengths and anything the
+// caller doesn't pass, and a string that is kept holds on to the other n-1
+// strings but nothing else.
+func Clone(n int, str func(i int) *string) {
+    size := 0
+    for i := 0; i < n; i++ {
+        size += len(*str(i))
+    }
+
+    var b strings.Builder
+    b.Grow(size)
+    for i := 0; i < n; i++ {
+        b.WriteString(*str(i))
+    }
+
+    all := b.String()
+    for i := 0; i < n; i++ {
+        s := str(i)
+        *s, all = all[:len(*s)], all[len(*s):]
+    }
+}
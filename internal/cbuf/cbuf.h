@@ -0,0 +1,90 @@
+/*
+ * Helpers that run a libpostal call and copy its result into one malloc'd
+ * buffer before destroying it, so that Go can read the whole result in place
+ * and copy the strings it keeps into one allocation instead of one per string.
+ *
+ * The buffer holds a uint32_t count followed by that many strings, each a
+ * uint32_t length and its bytes without a terminating NUL. Integers are in
+ * native byte order. The caller frees the buffer with free().
+ */
+#ifndef GOPOSTAL_CBUF_H
+#define GOPOSTAL_CBUF_H
+
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libpostal/libpostal.h>
+
+static inline char *cbuf_put_uint32(char *p, uint32_t v) {
+    memcpy(p, &v, sizeof(v));
+    return p + sizeof(v);
+}
+
+static inline char *cbuf_put_string(char *p, const char *s, size_t len) {
+    p = cbuf_put_uint32(p, (uint32_t)len);
+    memcpy(p, s, len);
+    return p + len;
+}
+
+/*
+ * Serializes the first n strings of each of the num_arrays arrays, taking one
+ * string from each array in turn. Returns NULL if the allocation fails.
+ */
+static inline char *cbuf_strings(char ***arrays, size_t num_arrays, size_t n, size_t *size) {
+    size_t total = sizeof(uint32_t);
+    for (size_t i = 0; i < n; i++) {
+        for (size_t j = 0; j < num_arrays; j++) {
+            total += sizeof(uint32_t) + strlen(arrays[j][i]);
+        }
+    }
+
+    char *buf = malloc(total);
+    if (buf == NULL) {
+        return NULL;
+    }
+
+    char *p = cbuf_put_uint32(buf, (uint32_t)(n * num_arrays));
+    for (size_t i = 0; i < n; i++) {
+        for (size_t j = 0; j < num_arrays; j++) {
+            p = cbuf_put_string(p, arrays[j][i], strlen(arrays[j][i]));
+        }
+    }
+
+    *size = total;
+    return buf;
+}
+
+/* Parses address into alternating labels and values. */
+static inline char *cbuf_parse_address(char *address, libpostal_address_parser_options_t options, size_t *size) {
+    libpostal_address_parser_response_t *response = libpostal_parse_address(address, options);
+    if (response == NULL) {
+        return NULL;
+    }
+
+    char **arrays[] = {response->labels, response->components};
+    char *buf = cbuf_strings(arrays, 2, response->num_components, size);
+
+    libpostal_address_parser_response_destroy(response);
+    return buf;
+}
+
+static inline char *cbuf_expand_address(char *address, libpostal_normalize_options_t options, bool root, size_t *size) {
+    size_t num_expansions = 0;
+    char **expansions;
+    if (root) {
+        expansions = libpostal_expand_address_root(address, options, &num_expansions);
+    } else {
+        expansions = libpostal_expand_address(address, options, &num_expansions);
+    }
+    if (expansions == NULL) {
+        return NULL;
+    }
+
+    char **arrays[] = {expansions};
+    char *buf = cbuf_strings(arrays, 1, num_expansions, size);
+
+    libpostal_expansion_array_destroy(expansions, num_expansions);
+    return buf;
+}
+
+#endif
@@ -0,0 +1,100 @@
+package cbuf
+
+import (
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+// encode builds a buffer in the layout written by cbuf.h.
+func encode(strs ...string) string {
+	buf := binary.NativeEndian.AppendUint32(nil, uint32(len(strs)))
+	for _, s := range strs {
+		buf = binary.NativeEndian.AppendUint32(buf, uint32(len(s)))
+		buf = append(buf, s...)
+	}
+	return string(buf)
+}
+
+func TestReader(t *testing.T) {
+	expected := []string{"house_number", "781", "road", "", "city", "東京"}
+
+	r, n, err := NewReader(encode(expected...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) {
+		t.Fatalf("expected %d strings, got %d", len(expected), n)
+	}
+
+	strs := make([]string, n)
+	for i := range strs {
+		if strs[i], err = r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !reflect.DeepEqual(strs, expected) {
+		t.Errorf("strings: %q != %q", strs, expected)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed past the end, got %v", err)
+	}
+}
+
+func TestReaderMalformed(t *testing.T) {
+	buf := encode("franklin ave", "brooklyn")
+
+	for i := 0; i < len(buf); i++ {
+		r, n, err := NewReader(buf[:i])
+		for j := 0; err == nil && j < n; j++ {
+			_, err = r.Next()
+		}
+		if !errors.Is(err, ErrMalformed) {
+			t.Errorf("expected ErrMalformed for %d of %d bytes, got %v", i, len(buf), err)
+		}
+	}
+
+	// A count larger than the buffer could hold.
+	if _, _, err := NewReader(string(binary.NativeEndian.AppendUint32(nil, 1<<30))); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed for a bad count, got %v", err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	// Read in place, as the cgo packages read C memory.
+	buf := []byte(encode("house_number", "781", "road", "franklin ave", "city", ""))
+	r, n, err := NewReader(unsafe.String(&buf[0], len(buf)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	strs := make([]string, n)
+	for i := range strs {
+		if strs[i], err = r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Only the values, as the parser keeps them.
+	values := []string{strs[1], strs[3], strs[5]}
+	Clone(len(values), func(i int) *string {
+		return &values[i]
+	})
+
+	// Overwriting the buffer, as freeing it would, leaves the copies intact.
+	for i := range buf {
+		buf[i] = 0
+	}
+	expected := []string{"781", "franklin ave", ""}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("values: %q != %q", values, expected)
+	}
+
+	// The copies share one allocation without the lengths between them.
+	if unsafe.StringData(values[1]) != (*byte)(unsafe.Add(unsafe.Pointer(unsafe.StringData(values[0])), len(values[0]))) {
+		t.Error("expected the values to be contiguous")
+	}
+}
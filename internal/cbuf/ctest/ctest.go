@@ -0,0 +1,54 @@
+// Package ctest exposes the C helpers in cbuf.h to Go tests, which can't use
+// cgo themselves.
+package ctest
+
+/*
+#cgo pkg-config: libpostal
+#cgo CFLAGS: -I${SRCDIR}/..
+#include <stdlib.h>
+#include "cbuf.h"
+
+// strings holds num_arrays arrays of n strings each, one after the other.
+static char *ctest_strings(char **strings, size_t num_arrays, size_t n, size_t *size) {
+    char **arrays[num_arrays > 0 ? num_arrays : 1];
+    for (size_t j = 0; j < num_arrays; j++) {
+        arrays[j] = strings + j * n;
+    }
+    return cbuf_strings(arrays, num_arrays, n, size);
+}
+*/
+import "C"
+
+import (
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/cstrings"
+)
+
+// Strings serializes arrays, which must all have the same length, with
+// cbuf_strings, and returns the buffer it writes.
+func Strings(arrays [][]string) string {
+    var flat []string
+    n := 0
+    if len(arrays) > 0 {
+        n = len(arrays[0])
+    }
+    for _, array := range arrays {
+        if len(array) != n {
+            panic("ctest: arrays have different lengths")
+        }
+        flat = append(flat, array...)
+    }
+
+    cStrings := cstrings.NewArray(flat)
+    defer cStrings.Free()
+
+    var cSize C.size_t
+    cBuf := C.ctest_strings((**C.char)(cStrings.Pointer()), C.size_t(len(arrays)), C.size_t(n), &cSize)
+    if cBuf == nil {
+        panic("ctest: cbuf_strings failed")
+    }
+    defer C.free(unsafe.Pointer(cBuf))
+
+    return C.GoStringN(cBuf, C.int(cSize))
+}
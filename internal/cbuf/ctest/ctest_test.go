@@ -0,0 +1,51 @@
+package ctest
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/openvenues/gopostal/internal/cbuf"
+)
+
+func TestStrings(t *testing.T) {
+	testCases := []struct {
+		name     string
+		arrays   [][]string
+		expected []string
+	}{
+		{"Empty", nil, []string{}},
+		{"No strings", [][]string{{}, {}}, []string{}},
+		{"One array", [][]string{{"781 franklin ave", "", "東京都"}}, []string{"781 franklin ave", "", "東京都"}},
+		{
+			"Interleaved",
+			[][]string{{"house_number", "road"}, {"781", "franklin ave"}},
+			[]string{"house_number", "781", "road", "franklin ave"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			buf := Strings(tc.arrays)
+
+			r, n, err := cbuf.NewReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			strs := make([]string, n)
+			for i := range strs {
+				if strs[i], err = r.Next(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(strs, tc.expected) {
+				t.Errorf("strings != expected: %q != %q", strs, tc.expected)
+			}
+
+			// The reported size covers the whole buffer and nothing more.
+			if _, err := r.Next(); err != cbuf.ErrMalformed {
+				t.Errorf("expected the buffer to end, got %v", err)
+			}
+		})
+	}
+}
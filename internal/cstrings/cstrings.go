@@ -0,0 +1,75 @@
+// Package cstrings marshals Go string slices to and from the char ** arrays
+// used throughout the libpostal API.
+package cstrings
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "unsafe"
+)
+
+// Array is a C-allocated char ** holding copies of Go strings. Packages
+// using it convert Pointer() to their own (**C.char) type.
+type Array struct {
+    ptr unsafe.Pointer
+    n int
+}
+
+func NewArray(strs []string) *Array {
+    if len(strs) == 0 {
+        return &Array{}
+    }
+
+    var char_ptr *C.char
+    ptr_size := unsafe.Sizeof(char_ptr)
+
+    cArray := C.calloc(C.size_t(len(strs)), C.size_t(ptr_size))
+    cArrayPtr := (*[1<<30](*C.char))(cArray)[:len(strs):len(strs)]
+
+    for i := 0; i < len(strs); i++ {
+        cArrayPtr[i] = C.CString(strs[i])
+    }
+
+    return &Array{ptr: cArray, n: len(strs)}
+}
+
+// Pointer returns the char ** array, or nil if the array is empty.
+func (a *Array) Pointer() unsafe.Pointer {
+    return a.ptr
+}
+
+func (a *Array) Len() int {
+    return a.n
+}
+
+func (a *Array) Free() {
+    if a.ptr == nil {
+        return
+    }
+
+    cArrayPtr := (*[1<<30](*C.char))(a.ptr)[:a.n:a.n]
+    for i := 0; i < a.n; i++ {
+        C.free(unsafe.Pointer(cArrayPtr[i]))
+    }
+    C.free(a.ptr)
+
+    a.ptr = nil
+    a.n = 0
+}
+
+// GoStrings copies n C strings out of the char ** array at ptr.
+func GoStrings(ptr unsafe.Pointer, n int) []string {
+    slice := make([]string, n)
+    if n == 0 {
+        return slice
+    }
+
+    cArrayPtr := (*[1<<30](*C.char))(ptr)[:n:n]
+    for i := 0; i < n; i++ {
+        slice[i] = C.GoString(cArrayPtr[i])
+    }
+    return slice
+}
@@ -0,0 +1,43 @@
+package cstrings
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArrayRoundTrip(t *testing.T) {
+	strs := []string{"en", "fr", "日本語", ""}
+
+	array := NewArray(strs)
+	defer array.Free()
+
+	if array.Len() != len(strs) {
+		t.Fatalf("Len() = %d, want %d", array.Len(), len(strs))
+	}
+
+	if got := GoStrings(array.Pointer(), array.Len()); !reflect.DeepEqual(got, strs) {
+		t.Errorf("GoStrings != input:\nGot:  %q\nWant: %q", got, strs)
+	}
+}
+
+func TestEmptyArray(t *testing.T) {
+	array := NewArray(nil)
+	if array.Pointer() != nil || array.Len() != 0 {
+		t.Errorf("expected nil pointer for empty array, got %v (len %d)", array.Pointer(), array.Len())
+	}
+	array.Free()
+
+	if got := GoStrings(nil, 0); got == nil || len(got) != 0 {
+		t.Errorf("GoStrings(nil, 0) = %#v, want empty slice", got)
+	}
+}
+
+func TestFreeTwice(t *testing.T) {
+	array := NewArray([]string{"a"})
+	array.Free()
+	array.Free()
+
+	if array.Pointer() != nil || array.Len() != 0 {
+		t.Error("Free did not reset the array")
+	}
+}
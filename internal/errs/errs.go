@@ -0,0 +1,18 @@
+// Package errs defines the sentinel errors shared by the public packages, so
+// that e.g. parser.ErrInvalidUTF8 and expand.ErrInvalidUTF8 are the same
+// value and can be matched with errors.Is regardless of which package
+// returned them.
+package errs
+
+import (
+    "errors"
+)
+
+var (
+    ErrInvalidUTF8 = errors.New("postal: invalid UTF-8 input")
+    ErrLengthMismatch = errors.New("postal: labels and values have different lengths")
+    ErrEmptyInput = errors.New("postal: empty input")
+    ErrNotInitialized = errors.New("postal: libpostal is not initialized")
+    ErrLibpostal = errors.New("postal: libpostal returned no result")
+    ErrInvalidLabel = errors.New("postal: invalid label")
+)
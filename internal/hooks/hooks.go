@@ -0,0 +1,96 @@
+// Package hooks times calls into libpostal and reports them to the observer
+// set through the public observe package.
+package hooks
+
+import (
+    "context"
+    "sync/atomic"
+    "time"
+
+    "github.com/openvenues/gopostal/internal/lifecycle"
+)
+
+type Event struct {
+    // Package and function, e.g. "parser.ParseAddress".
+    Op string
+    // Length of the input in bytes, summed over all strings passed in.
+    InputLen int
+    // Time spent waiting for the lock shared by all calls into libpostal.
+    LockWait time.Duration
+    // Time spent holding the lock, including loading models on first use.
+    Duration time.Duration
+    // Number of components, expansions, hashes or languages returned, or 1
+    // for a duplicate status.
+    Results int
+    Err error
+}
+
+type Observer interface {
+    Observe(Event)
+}
+
+type holder struct {
+    observer Observer
+}
+
+var current atomic.Pointer[holder]
+
+func SetObserver(observer Observer) {
+    if observer == nil {
+        current.Store(nil)
+        return
+    }
+    current.Store(&holder{observer: observer})
+}
+
+// Call measures one call. Its methods do nothing when no observer is set.
+type Call struct {
+    observer Observer
+    event Event
+    locked time.Time
+}
+
+func Start(op string, inputLen int) Call {
+    h := current.Load()
+    if h == nil {
+        return Call{}
+    }
+    return Call{observer: h.observer, event: Event{Op: op, InputLen: inputLen}}
+}
+
+// Lock acquires the lifecycle lock, recording how long that took.
+func (c *Call) Lock() {
+    c.LockContext(context.Background())
+}
+
+// LockContext is Lock, but gives up and returns ctx.Err() if ctx is done
+// first.
+func (c *Call) LockContext(ctx context.Context) error {
+    if c.observer == nil {
+        return lifecycle.LockContext(ctx)
+    }
+
+    start := time.Now()
+    err := lifecycle.LockContext(ctx)
+    c.locked = time.Now()
+    c.event.LockWait = c.locked.Sub(start)
+    if err != nil {
+        c.locked = time.Time{}
+    }
+    return err
+}
+
+// Done reports the call to the observer. It must be called after the lock is
+// released, so that the observer doesn't hold up other calls.
+func (c *Call) Done(results int, err error) {
+    if c.observer == nil {
+        return
+    }
+
+    if !c.locked.IsZero() {
+        c.event.Duration = time.Since(c.locked)
+    }
+    c.event.Results = results
+    c.event.Err = err
+    c.observer.Observe(c.event)
+}
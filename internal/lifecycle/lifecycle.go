@@ -0,0 +1,317 @@
+// Package lifecycle owns libpostal's global state on behalf of the public
+// packages: the lock that serializes calls into the library, and
+// reference-counted loading and unloading of its data files.
+package lifecycle
+
+/*
+#cgo pkg-config: libpostal
+#include <libpostal/libpostal.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "time"
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/errs"
+)
+
+const DataDirEnv = "GOPOSTAL_DATADIR"
+
+// Config selects the directories libpostal loads its models from. Empty
+// fields fall back to DataDir, then to $GOPOSTAL_DATADIR, then to the
+// directory libpostal was configured with at build time.
+//
+// If IdleTimeout is positive, a component that hasn't been used for that long
+// is unloaded, and loaded again on its next use.
+type Config struct {
+    DataDir string
+    ParserDataDir string
+    LanguageClassifierDataDir string
+    IdleTimeout time.Duration
+}
+
+func (c Config) dataDir() string {
+    if c.DataDir != "" {
+        return c.DataDir
+    }
+    return os.Getenv(DataDirEnv)
+}
+
+func (c Config) parserDataDir() string {
+    if c.ParserDataDir != "" {
+        return c.ParserDataDir
+    }
+    return c.dataDir()
+}
+
+func (c Config) languageClassifierDataDir() string {
+    if c.LanguageClassifierDataDir != "" {
+        return c.LanguageClassifierDataDir
+    }
+    return c.dataDir()
+}
+
+type Component uint8
+
+const (
+    Core Component = 1 << iota
+    Parser
+    LanguageClassifier
+)
+
+// sem serializes every call into libpostal, including setup and teardown.
+// libpostal keeps global state, so there is one lock for all packages. It is a
+// channel rather than a sync.Mutex so that waiting for it can be abandoned.
+var (
+    sem = make(chan struct{}, 1)
+    loaded Component
+    refs = map[Component]int{}
+    config Config
+
+    // Only maintained while config.IdleTimeout is positive.
+    lastUsed = map[Component]time.Time{}
+    idleTimer *time.Timer
+)
+
+func Lock() {
+    sem <- struct{}{}
+}
+
+// LockContext acquires the lock unless ctx is done first, in which case it
+// returns ctx.Err().
+func LockContext(ctx context.Context) error {
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+
+    select {
+    case sem <- struct{}{}:
+        return nil
+    case <-ctx.Done():
+        return ctx.Err()
+    }
+}
+
+func Unlock() {
+    <-sem
+}
+
+// Handle is a package's reference to the components it uses. A component is
+// unloaded only once every handle holding it has been torn down.
+type Handle struct {
+    components Component
+    held bool
+}
+
+func NewHandle(components Component) *Handle {
+    return &Handle{components: components | Core}
+}
+
+// Setup loads the handle's components from the directories in c. Components
+// that are already loaded are left alone, and c becomes the configuration used
+// to load any components needed later by Ensure.
+func (h *Handle) Setup(c Config) error {
+    Lock()
+    defer Unlock()
+
+    config = c
+    return h.ensure()
+}
+
+// Ensure loads the handle's components if needed, using the configuration from
+// the last call to Setup. The caller must hold the lock.
+func (h *Handle) Ensure() error {
+    if h.held && loaded&h.components == h.components {
+        h.touch()
+        return nil
+    }
+    return h.ensure()
+}
+
+// Loaded reports whether all of the handle's components are loaded.
+func (h *Handle) Loaded() bool {
+    return Loaded(h.components)
+}
+
+// Teardown releases the handle's components, unloading those no other handle
+// still holds. A later call to Ensure or Setup loads them again.
+func (h *Handle) Teardown() {
+    Lock()
+    defer Unlock()
+
+    if !h.held {
+        return
+    }
+    h.held = false
+
+    var unused Component
+    for _, component := range []Component{Core, Parser, LanguageClassifier} {
+        if h.components&component == 0 {
+            continue
+        }
+        refs[component]--
+        if refs[component] == 0 {
+            unused |= component
+        }
+    }
+
+    unload(unused)
+}
+
+func (h *Handle) ensure() error {
+    if err := load(h.components); err != nil {
+        return err
+    }
+
+    if !h.held {
+        for _, component := range []Component{Core, Parser, LanguageClassifier} {
+            if h.components&component != 0 {
+                refs[component]++
+            }
+        }
+        h.held = true
+    }
+
+    h.touch()
+    return nil
+}
+
+// touch records that the handle's components were just used, and makes sure
+// the idle timer is running.
+func (h *Handle) touch() {
+    if config.IdleTimeout <= 0 {
+        return
+    }
+
+    now := time.Now()
+    for _, component := range []Component{Core, Parser, LanguageClassifier} {
+        if h.components&component != 0 {
+            lastUsed[component] = now
+        }
+    }
+
+    if idleTimer == nil {
+        idleTimer = time.AfterFunc(config.IdleTimeout, unloadIdle)
+    }
+}
+
+// unloadIdle unloads the components that have been idle for
+// config.IdleTimeout, and schedules itself again for the rest.
+func unloadIdle() {
+    Lock()
+    defer Unlock()
+
+    idleTimer = nil
+    if config.IdleTimeout <= 0 {
+        return
+    }
+
+    now := time.Now()
+    var idle Component
+    var next time.Duration
+    for _, component := range []Component{Core, Parser, LanguageClassifier} {
+        if loaded&component == 0 {
+            continue
+        }
+
+        remaining := config.IdleTimeout - now.Sub(lastUsed[component])
+        if remaining <= 0 {
+            idle |= component
+        } else if next == 0 || remaining < next {
+            next = remaining
+        }
+    }
+
+    // The parser and classifier rely on the core data, so it stays loaded
+    // while either of them does.
+    if (loaded&^idle)&(Parser|LanguageClassifier) != 0 {
+        idle &^= Core
+    }
+    unload(idle)
+
+    if loaded != 0 {
+        idleTimer = time.AfterFunc(next, unloadIdle)
+    }
+}
+
+func Loaded(components Component) bool {
+    Lock()
+    defer Unlock()
+
+    return loaded&components == components
+}
+
+func load(components Component) error {
+    // The parser and language classifier both rely on the core data.
+    if components != 0 {
+        components |= Core
+    }
+
+    if components&Core != 0 && loaded&Core == 0 {
+        dir := config.dataDir()
+        if !bool(withDir(dir, func(cDir *C.char) C.bool { return C.libpostal_setup_datadir(cDir) })) {
+            return setupError("libpostal", dir)
+        }
+        loaded |= Core
+    }
+
+    if components&Parser != 0 && loaded&Parser == 0 {
+        dir := config.parserDataDir()
+        if !bool(withDir(dir, func(cDir *C.char) C.bool { return C.libpostal_setup_parser_datadir(cDir) })) {
+            return setupError("libpostal parser", dir)
+        }
+        loaded |= Parser
+    }
+
+    if components&LanguageClassifier != 0 && loaded&LanguageClassifier == 0 {
+        dir := config.languageClassifierDataDir()
+        if !bool(withDir(dir, func(cDir *C.char) C.bool { return C.libpostal_setup_language_classifier_datadir(cDir) })) {
+            return setupError("libpostal language classifier", dir)
+        }
+        loaded |= LanguageClassifier
+    }
+
+    return nil
+}
+
+func unload(components Component) {
+    if components&Parser != 0 && loaded&Parser != 0 {
+        C.libpostal_teardown_parser()
+        loaded &^= Parser
+    }
+
+    if components&LanguageClassifier != 0 && loaded&LanguageClassifier != 0 {
+        C.libpostal_teardown_language_classifier()
+        loaded &^= LanguageClassifier
+    }
+
+    if components&Core != 0 && loaded&Core != 0 {
+        C.libpostal_teardown()
+        loaded &^= Core
+    }
+}
+
+// withDir calls f with dir as a C string, or with NULL if dir is empty so that
+// libpostal falls back to its default data directory.
+func withDir(dir string, f func(*C.char) C.bool) C.bool {
+    if dir == "" {
+        return f(nil)
+    }
+
+    cDir := C.CString(dir)
+    defer C.free(unsafe.Pointer(cDir))
+
+    return f(cDir)
+}
+
+func setupError(what string, dir string) error {
+    if dir == "" {
+        return fmt.Errorf("%w: could not load %s from the default data directory", errs.ErrNotInitialized, what)
+    }
+    return fmt.Errorf("%w: could not load %s from %s", errs.ErrNotInitialized, what, dir)
+}
@@ -0,0 +1,192 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/openvenues/gopostal/internal/errs"
+)
+
+func TestConfigDataDirs(t *testing.T) {
+	os.Setenv(DataDirEnv, "/env/libpostal")
+	defer os.Unsetenv(DataDirEnv)
+
+	testCases := []struct {
+		name                      string
+		config                    Config
+		dataDir                   string
+		parserDataDir             string
+		languageClassifierDataDir string
+	}{
+		{"Environment fallback", Config{}, "/env/libpostal", "/env/libpostal", "/env/libpostal"},
+		{"Data dir", Config{DataDir: "/data"}, "/data", "/data", "/data"},
+		{"Parser data dir", Config{DataDir: "/data", ParserDataDir: "/parser"}, "/data", "/parser", "/data"},
+		{"Classifier data dir", Config{LanguageClassifierDataDir: "/classifier"}, "/env/libpostal", "/env/libpostal", "/classifier"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.config.dataDir(); got != tc.dataDir {
+				t.Errorf("dataDir() = %q, want %q", got, tc.dataDir)
+			}
+			if got := tc.config.parserDataDir(); got != tc.parserDataDir {
+				t.Errorf("parserDataDir() = %q, want %q", got, tc.parserDataDir)
+			}
+			if got := tc.config.languageClassifierDataDir(); got != tc.languageClassifierDataDir {
+				t.Errorf("languageClassifierDataDir() = %q, want %q", got, tc.languageClassifierDataDir)
+			}
+		})
+	}
+}
+
+func TestSetupInvalidDataDir(t *testing.T) {
+	handle := NewHandle(Core)
+
+	if err := handle.Setup(Config{DataDir: "/nonexistent/libpostal"}); !errors.Is(err, errs.ErrNotInitialized) {
+		t.Errorf("expected ErrNotInitialized for a missing data directory, got %v", err)
+	}
+
+	if Loaded(Core) {
+		t.Error("core reported as loaded after a failed setup")
+	}
+
+	// Later loads fall back to the default data directory again.
+	if err := handle.Setup(Config{}); err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+	handle.Teardown()
+}
+
+func TestSharedTeardown(t *testing.T) {
+	parser := NewHandle(Parser)
+	classifier := NewHandle(LanguageClassifier)
+
+	if err := parser.Setup(Config{}); err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+	if err := classifier.Setup(Config{}); err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+
+	if !Loaded(Core | Parser | LanguageClassifier) {
+		t.Fatal("Setup did not load all components")
+	}
+
+	classifier.Teardown()
+
+	if !Loaded(Core | Parser) {
+		t.Error("tearing down the classifier unloaded components still held by the parser")
+	}
+	if Loaded(LanguageClassifier) {
+		t.Error("classifier still loaded after its only handle was torn down")
+	}
+
+	// Tearing down twice must not release the parser's references.
+	classifier.Teardown()
+	if !Loaded(Core | Parser) {
+		t.Error("second teardown released references it did not hold")
+	}
+
+	Lock()
+	err := classifier.Ensure()
+	Unlock()
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !Loaded(LanguageClassifier) {
+		t.Error("Ensure did not reload the classifier")
+	}
+
+	parser.Teardown()
+	classifier.Teardown()
+
+	if Loaded(Core) || Loaded(Parser) || Loaded(LanguageClassifier) {
+		t.Error("components still loaded after every handle was torn down")
+	}
+}
+
+func TestLockContext(t *testing.T) {
+	Lock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := LockContext(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	Unlock()
+
+	if err := LockContext(context.Background()); err != nil {
+		t.Fatalf("LockContext on a free lock: %v", err)
+	}
+	Unlock()
+
+	// A context that is already done never acquires the lock.
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for i := 0; i < 100; i++ {
+		if err := LockContext(canceled); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	}
+}
+
+func TestIdleUnload(t *testing.T) {
+	const idleTimeout = 50 * time.Millisecond
+
+	parser := NewHandle(Parser)
+	classifier := NewHandle(LanguageClassifier)
+	defer parser.Teardown()
+	defer classifier.Teardown()
+	defer func() {
+		Lock()
+		config = Config{}
+		Unlock()
+	}()
+
+	if err := parser.Setup(Config{IdleTimeout: idleTimeout}); err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+	if err := classifier.Setup(Config{IdleTimeout: idleTimeout}); err != nil {
+		t.Fatalf("Setup returned error: %v", err)
+	}
+
+	// Keep using the classifier while the parser goes idle.
+	deadline := time.Now().Add(4 * idleTimeout)
+	for time.Now().Before(deadline) {
+		Lock()
+		err := classifier.Ensure()
+		Unlock()
+		if err != nil {
+			t.Fatalf("Ensure returned error: %v", err)
+		}
+		time.Sleep(idleTimeout / 10)
+	}
+
+	if parser.Loaded() {
+		t.Error("parser still loaded after being idle")
+	}
+	if !classifier.Loaded() {
+		t.Error("classifier unloaded while in use")
+	}
+
+	// Everything unloads once nothing is used.
+	time.Sleep(4 * idleTimeout)
+	if Loaded(Core) || Loaded(LanguageClassifier) {
+		t.Error("components still loaded after being idle")
+	}
+
+	// The next use loads the parser again.
+	Lock()
+	err := parser.Ensure()
+	Unlock()
+	if err != nil {
+		t.Fatalf("Ensure returned error: %v", err)
+	}
+	if !parser.Loaded() {
+		t.Error("Ensure did not reload the idle parser")
+	}
+}
@@ -0,0 +1,6 @@
+// Package soak holds a long-running test that calls every package a million
+// times and checks that the process's memory stays flat. It is excluded from
+// normal test runs; run it with
+//
+//     go test -tags soak -timeout 1h ./internal/soak
+package soak
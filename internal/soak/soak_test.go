@@ -0,0 +1,165 @@
+//go:build soak && linux
+
+package soak
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"testing"
+
+	classify "github.com/openvenues/gopostal/classify"
+	expand "github.com/openvenues/gopostal/expand"
+	neardupe "github.com/openvenues/gopostal/neardupe"
+	normalize "github.com/openvenues/gopostal/normalize"
+	parser "github.com/openvenues/gopostal/parser"
+	tokenize "github.com/openvenues/gopostal/tokenize"
+)
+
+var (
+	calls     = flag.Int("soak.calls", 1000000, "number of calls to make")
+	maxGrowth = flag.Int64("soak.maxgrowth", 32<<20, "maximum growth in resident memory, in bytes")
+)
+
+// rss returns the resident set size of the process, in bytes.
+func rss(t *testing.T) int64 {
+	t.Helper()
+
+	statm, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := strings.Fields(string(statm))
+	if len(fields) < 2 {
+		t.Fatalf("unexpected /proc/self/statm: %q", statm)
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages * int64(os.Getpagesize())
+}
+
+func settledRSS(t *testing.T) int64 {
+	runtime.GC()
+	debug.FreeOSMemory()
+	return rss(t)
+}
+
+var (
+	address = "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+	labels  = []string{"house", "house_number", "road", "city", "postcode"}
+	values  = []string{"Brooklyn Museum", "200", "Eastern Pkwy", "Brooklyn", "11238"}
+)
+
+// check turns an empty result into an error, so that a call that quietly does
+// nothing can't pass for one that doesn't leak.
+func check(n int, err error) error {
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return errors.New("empty result")
+	}
+	return nil
+}
+
+func checkStatus(status neardupe.DuplicateStatus, err error) error {
+	if err != nil {
+		return err
+	}
+	if status == neardupe.NullDuplicate {
+		return errors.New("null duplicate status")
+	}
+	return nil
+}
+
+// Each call exercises a function that returns memory allocated by libpostal.
+var soakCalls = []struct {
+	name string
+	call func() error
+}{
+	{"ParseAddress", func() error {
+		components, err := parser.ParseAddressOptionsE(address, parser.ParserOptions{})
+		return check(len(components), err)
+	}},
+	{"ExpandAddress", func() error {
+		expansions, err := expand.ExpandAddressOptionsE(address, expand.GetDefaultExpansionOptions())
+		return check(len(expansions), err)
+	}},
+	{"ExpandAddressRoot", func() error {
+		expansions, err := expand.ExpandAddressRootOptionsE(address, expand.GetDefaultExpansionOptions())
+		return check(len(expansions), err)
+	}},
+	{"NearDupe", func() error {
+		hashes, err := neardupe.NearDupeOptionsE(labels, values, neardupe.GetDefaultNearDupeHashOptions(), nil)
+		return check(len(hashes), err)
+	}},
+	{"NearDupeLanguages", func() error {
+		hashes, err := neardupe.NearDupeOptionsE(labels, values, neardupe.GetDefaultNearDupeHashOptions(), []string{"en"})
+		return check(len(hashes), err)
+	}},
+	{"NearDupeNames", func() error {
+		hashes, err := neardupe.NearDupeNameOptionsE("Brooklyn Museum", neardupe.GetDefaultNormalizeOptions())
+		return check(len(hashes), err)
+	}},
+	{"PlaceLanguages", func() error {
+		languages, err := neardupe.PlaceLanguagesE(labels, values)
+		return check(len(languages), err)
+	}},
+	{"IsToponymDuplicate", func() error {
+		return checkStatus(neardupe.IsToponymDuplicateOptionsE(labels, values, labels, values, neardupe.GetDefaultNormalizeOptions()))
+	}},
+	{"IsNameDuplicateFuzzy", func() error {
+		tokens, scores := []string{"brooklyn", "museum"}, []float64{0.5, 0.5}
+		result, err := neardupe.IsNameDuplicateFuzzyOptionsE(tokens, scores, tokens, scores, neardupe.GetDefaultFuzzyDuplicateOptions())
+		return checkStatus(result.Status, err)
+	}},
+	{"ClassifyLanguage", func() error {
+		scores, err := classify.ClassifyLanguageE(address)
+		return check(len(scores), err)
+	}},
+	{"Tokenize", func() error {
+		tokens, err := tokenize.Tokenize(address)
+		return check(len(tokens), err)
+	}},
+	{"NormalizedTokens", func() error {
+		tokens, err := normalize.NormalizedTokens(address)
+		return check(len(tokens), err)
+	}},
+	{"NormalizeString", func() error {
+		normalized, err := normalize.NormalizeString(address, normalize.DefaultStringOptions, nil)
+		return check(len(normalized), err)
+	}},
+}
+
+// run makes the i'th soak call, failing the test on the first error.
+func run(t *testing.T, i int) {
+	t.Helper()
+	c := soakCalls[i%len(soakCalls)]
+	if err := c.call(); err != nil {
+		t.Fatalf("%s (call %d): %v", c.name, i, err)
+	}
+}
+
+func TestMemoryStaysFlat(t *testing.T) {
+	// Warm up so that models, caches and the Go heap reach their steady size.
+	for i := 0; i < 10000; i++ {
+		run(t, i)
+	}
+	before := settledRSS(t)
+
+	for i := 0; i < *calls; i++ {
+		run(t, i)
+	}
+	after := settledRSS(t)
+
+	t.Logf("resident memory: %d MB before, %d MB after %d calls", before>>20, after>>20, *calls)
+	if growth := after - before; growth > *maxGrowth {
+		t.Errorf("resident memory grew by %d bytes over %d calls, limit %d", growth, *calls, *maxGrowth)
+	}
+}
@@ -0,0 +1,114 @@
+package postal
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/openvenues/gopostal/internal/errs"
+)
+
+var (
+    ErrInvalidLabel = errs.ErrInvalidLabel
+)
+
+// Label names an address component, as emitted by the parser and accepted by
+// neardupe.
+type Label string
+
+// Labels emitted by the parser.
+const (
+    House Label = "house"
+    Category Label = "category"
+    Near Label = "near"
+    HouseNumber Label = "house_number"
+    Road Label = "road"
+    Unit Label = "unit"
+    Level Label = "level"
+    Staircase Label = "staircase"
+    Entrance Label = "entrance"
+    PoBox Label = "po_box"
+    Postcode Label = "postcode"
+    Suburb Label = "suburb"
+    CityDistrict Label = "city_district"
+    City Label = "city"
+    Island Label = "island"
+    StateDistrict Label = "state_district"
+    State Label = "state"
+    CountryRegion Label = "country_region"
+    Country Label = "country"
+    WorldRegion Label = "world_region"
+)
+
+// Labels accepted by neardupe that the parser doesn't emit.
+const (
+    Building Label = "building"
+    MetroStation Label = "metro_station"
+    Phone Label = "phone"
+    Website Label = "website"
+)
+
+// Component is a labeled part of an address, as taken by the format package.
+type Component struct {
+    Label Label `json:"label"`
+    Value string `json:"value"`
+}
+
+var labels = []Label{
+    House,
+    Category,
+    Near,
+    HouseNumber,
+    Road,
+    Unit,
+    Level,
+    Staircase,
+    Entrance,
+    PoBox,
+    Postcode,
+    Suburb,
+    CityDistrict,
+    City,
+    Island,
+    StateDistrict,
+    State,
+    CountryRegion,
+    Country,
+    WorldRegion,
+    Building,
+    MetroStation,
+    Phone,
+    Website,
+}
+
+// Labels returns every valid label.
+func Labels() []Label {
+    return append([]Label(nil), labels...)
+}
+
+func (l Label) IsValid() bool {
+    for _, valid := range labels {
+        if l == valid {
+            return true
+        }
+    }
+    return false
+}
+
+// Validate returns an error wrapping ErrInvalidLabel, and listing the valid
+// labels, for the first of labels that isn't valid.
+func Validate(labels []string) error {
+    for _, l := range labels {
+        if !Label(l).IsValid() {
+            return invalidLabelError(l)
+        }
+    }
+    return nil
+}
+
+func invalidLabelError(l string) error {
+    valid := make([]string, len(labels))
+    for i, label := range labels {
+        valid[i] = string(label)
+    }
+    return fmt.Errorf("%w %q, valid labels are: %s", ErrInvalidLabel, l, strings.Join(valid, ", "))
+}
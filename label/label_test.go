@@ -0,0 +1,42 @@
+package postal
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIsValid(t *testing.T) {
+	for _, l := range Labels() {
+		if !l.IsValid() {
+			t.Errorf("%q is not valid", l)
+		}
+	}
+
+	for _, l := range []Label{"", "house_num", "Road", "name", " road"} {
+		if l.IsValid() {
+			t.Errorf("%q is valid", l)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]string{"house_number", "road", "postcode"}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := Validate([]string{"house_num", "road"})
+	if !errors.Is(err, ErrInvalidLabel) {
+		t.Fatalf("expected ErrInvalidLabel, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `"house_num"`) || !strings.Contains(err.Error(), "house_number") {
+		t.Errorf("error doesn't name the label and the valid ones: %v", err)
+	}
+}
+
+func TestLabelsCopy(t *testing.T) {
+	Labels()[0] = "house_num"
+	if !House.IsValid() || Label("house_num").IsValid() {
+		t.Error("modifying the result of Labels changed the valid labels")
+	}
+}
@@ -0,0 +1,338 @@
+package postal
+
+/*
+#cgo pkg-config: libpostal
+#include <libpostal/libpostal.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "unicode/utf8"
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/cstrings"
+    "github.com/openvenues/gopostal/internal/hooks"
+    "github.com/openvenues/gopostal/internal/lifecycle"
+)
+
+type DuplicateStatus int
+
+const (
+    NullDuplicate DuplicateStatus = C.LIBPOSTAL_NULL_DUPLICATE_STATUS
+    NonDuplicate DuplicateStatus = C.LIBPOSTAL_NON_DUPLICATE
+    PossibleDuplicate DuplicateStatus = C.LIBPOSTAL_POSSIBLE_DUPLICATE_NEEDS_REVIEW
+    LikelyDuplicate DuplicateStatus = C.LIBPOSTAL_LIKELY_DUPLICATE
+    ExactDuplicate DuplicateStatus = C.LIBPOSTAL_EXACT_DUPLICATE
+)
+
+func (s DuplicateStatus) String() string {
+    switch s {
+    case NullDuplicate:
+        return "null"
+    case NonDuplicate:
+        return "non_duplicate"
+    case PossibleDuplicate:
+        return "possible_duplicate"
+    case LikelyDuplicate:
+        return "likely_duplicate"
+    case ExactDuplicate:
+        return "exact_duplicate"
+    }
+    return "unknown"
+}
+
+type cDuplicateFunc func(*C.char, *C.char, C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t
+
+func isDuplicate(op string, value1 string, value2 string, options NormalizeOptions, isDuplicateFunc cDuplicateFunc) (status DuplicateStatus, err error) {
+    call := hooks.Start(op, len(value1)+len(value2))
+    defer func() { call.Done(1, err) }()
+
+    if !utf8.ValidString(value1) || !utf8.ValidString(value2) {
+        return NullDuplicate, ErrInvalidUTF8
+    }
+
+    call.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return NullDuplicate, err
+    }
+
+    cValue1 := C.CString(value1)
+    defer C.free(unsafe.Pointer(cValue1))
+
+    cValue2 := C.CString(value2)
+    defer C.free(unsafe.Pointer(cValue2))
+
+    cLanguages := cstrings.NewArray(options.Languages)
+    defer cLanguages.Free()
+
+    cOptions := C.libpostal_get_duplicate_options_with_languages(C.size_t(cLanguages.Len()), (**C.char)(cLanguages.Pointer()))
+
+    return DuplicateStatus(isDuplicateFunc(cValue1, cValue2, cOptions)), nil
+}
+
+func IsNameDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsNameDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_name_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsNameDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsNameDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsNameDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsNameDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsStreetDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsStreetDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_street_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsStreetDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsStreetDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsStreetDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsStreetDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsHouseNumberDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsHouseNumberDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_house_number_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsHouseNumberDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsHouseNumberDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsHouseNumberDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsHouseNumberDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsPoBoxDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsPoBoxDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_po_box_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsPoBoxDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsPoBoxDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsPoBoxDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsPoBoxDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsUnitDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsUnitDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_unit_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsUnitDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsUnitDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsUnitDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsUnitDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsFloorDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsFloorDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_floor_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsFloorDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsFloorDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsFloorDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsFloorDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsPostalCodeDuplicateOptionsE(value1 string, value2 string, options NormalizeOptions) (DuplicateStatus, error) {
+    return isDuplicate("neardupe.IsPostalCodeDuplicate", value1, value2, options, func(cValue1 *C.char, cValue2 *C.char, cOptions C.libpostal_duplicate_options_t) C.libpostal_duplicate_status_t {
+        return C.libpostal_is_postal_code_duplicate(cValue1, cValue2, cOptions)
+    })
+}
+
+func IsPostalCodeDuplicateOptions(value1 string, value2 string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsPostalCodeDuplicateOptionsE(value1, value2, options)
+    return status
+}
+
+func IsPostalCodeDuplicate(value1 string, value2 string) DuplicateStatus {
+    return IsPostalCodeDuplicateOptions(value1, value2, libpostalDefaultOptions)
+}
+
+func IsToponymDuplicateOptionsE(labels1 []string, values1 []string, labels2 []string, values2 []string, options NormalizeOptions) (status DuplicateStatus, err error) {
+    call := hooks.Start("neardupe.IsToponymDuplicate", inputLen(labels1, values1, labels2, values2))
+    defer func() { call.Done(1, err) }()
+
+    if err := checkComponents(labels1, values1); err != nil {
+        return NullDuplicate, err
+    }
+    if err := checkComponents(labels2, values2); err != nil {
+        return NullDuplicate, err
+    }
+
+    numComponents1 := len(labels1)
+    numComponents2 := len(labels2)
+
+    call.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return NullDuplicate, err
+    }
+
+    cLabels1 := cstrings.NewArray(labels1)
+    defer cLabels1.Free()
+    cValues1 := cstrings.NewArray(values1)
+    defer cValues1.Free()
+    cLabels2 := cstrings.NewArray(labels2)
+    defer cLabels2.Free()
+    cValues2 := cstrings.NewArray(values2)
+    defer cValues2.Free()
+
+    cLanguages := cstrings.NewArray(options.Languages)
+    defer cLanguages.Free()
+
+    cOptions := C.libpostal_get_duplicate_options_with_languages(C.size_t(cLanguages.Len()), (**C.char)(cLanguages.Pointer()))
+
+    return DuplicateStatus(C.libpostal_is_toponym_duplicate(
+        C.size_t(numComponents1), (**C.char)(cLabels1.Pointer()), (**C.char)(cValues1.Pointer()),
+        C.size_t(numComponents2), (**C.char)(cLabels2.Pointer()), (**C.char)(cValues2.Pointer()),
+        cOptions,
+    )), nil
+}
+
+func IsToponymDuplicateOptions(labels1 []string, values1 []string, labels2 []string, values2 []string, options NormalizeOptions) DuplicateStatus {
+    status, _ := IsToponymDuplicateOptionsE(labels1, values1, labels2, values2, options)
+    return status
+}
+
+func IsToponymDuplicate(labels1 []string, values1 []string, labels2 []string, values2 []string) DuplicateStatus {
+    return IsToponymDuplicateOptions(labels1, values1, labels2, values2, libpostalDefaultOptions)
+}
+
+type FuzzyDuplicateOptions struct {
+    Languages []string
+    NeedsReviewThreshold float64
+    LikelyDupeThreshold float64
+}
+
+type FuzzyDuplicateResult struct {
+    Status DuplicateStatus
+    Similarity float64
+}
+
+var cFuzzyDefaultOptions = C.libpostal_get_default_fuzzy_duplicate_options()
+
+func GetDefaultFuzzyDuplicateOptions() FuzzyDuplicateOptions {
+    return FuzzyDuplicateOptions{
+        Languages: nil,
+        NeedsReviewThreshold: float64(cFuzzyDefaultOptions.needs_review_threshold),
+        LikelyDupeThreshold: float64(cFuzzyDefaultOptions.likely_dupe_threshold),
+    }
+}
+
+var libpostalDefaultFuzzyOptions = GetDefaultFuzzyDuplicateOptions()
+
+type cFuzzyDuplicateFunc func(C.size_t, **C.char, *C.double, C.size_t, **C.char, *C.double, C.libpostal_fuzzy_duplicate_options_t) C.libpostal_fuzzy_duplicate_status_t
+
+func isDuplicateFuzzy(op string, tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64, options FuzzyDuplicateOptions, isDuplicateFunc cFuzzyDuplicateFunc) (result FuzzyDuplicateResult, err error) {
+    nullResult := FuzzyDuplicateResult{Status: NullDuplicate}
+
+    call := hooks.Start(op, inputLen(tokens1, tokens2))
+    defer func() { call.Done(1, err) }()
+
+    if len(tokens1) != len(scores1) || len(tokens2) != len(scores2) {
+        return nullResult, ErrLengthMismatch
+    }
+
+    if len(tokens1) == 0 || len(tokens2) == 0 {
+        return nullResult, ErrEmptyInput
+    }
+
+    for _, tokens := range [][]string{tokens1, tokens2} {
+        for _, token := range tokens {
+            if !utf8.ValidString(token) {
+                return nullResult, ErrInvalidUTF8
+            }
+        }
+    }
+
+    call.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return nullResult, err
+    }
+
+    cTokens1 := cstrings.NewArray(tokens1)
+    defer cTokens1.Free()
+    cTokens2 := cstrings.NewArray(tokens2)
+    defer cTokens2.Free()
+
+    cLanguages := cstrings.NewArray(options.Languages)
+    defer cLanguages.Free()
+
+    cOptions := C.libpostal_get_default_fuzzy_duplicate_options_with_languages(C.size_t(cLanguages.Len()), (**C.char)(cLanguages.Pointer()))
+    cOptions.needs_review_threshold = C.double(options.NeedsReviewThreshold)
+    cOptions.likely_dupe_threshold = C.double(options.LikelyDupeThreshold)
+
+    cStatus := isDuplicateFunc(
+        C.size_t(len(tokens1)), (**C.char)(cTokens1.Pointer()), (*C.double)(unsafe.Pointer(&scores1[0])),
+        C.size_t(len(tokens2)), (**C.char)(cTokens2.Pointer()), (*C.double)(unsafe.Pointer(&scores2[0])),
+        cOptions,
+    )
+
+    return FuzzyDuplicateResult{
+        Status: DuplicateStatus(cStatus.status),
+        Similarity: float64(cStatus.similarity),
+    }, nil
+}
+
+func IsNameDuplicateFuzzyOptionsE(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64, options FuzzyDuplicateOptions) (FuzzyDuplicateResult, error) {
+    return isDuplicateFuzzy("neardupe.IsNameDuplicateFuzzy", tokens1, scores1, tokens2, scores2, options, func(cNumTokens1 C.size_t, cTokens1 **C.char, cScores1 *C.double, cNumTokens2 C.size_t, cTokens2 **C.char, cScores2 *C.double, cOptions C.libpostal_fuzzy_duplicate_options_t) C.libpostal_fuzzy_duplicate_status_t {
+        return C.libpostal_is_name_duplicate_fuzzy(cNumTokens1, cTokens1, cScores1, cNumTokens2, cTokens2, cScores2, cOptions)
+    })
+}
+
+func IsNameDuplicateFuzzyOptions(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64, options FuzzyDuplicateOptions) FuzzyDuplicateResult {
+    result, _ := IsNameDuplicateFuzzyOptionsE(tokens1, scores1, tokens2, scores2, options)
+    return result
+}
+
+func IsNameDuplicateFuzzy(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64) FuzzyDuplicateResult {
+    return IsNameDuplicateFuzzyOptions(tokens1, scores1, tokens2, scores2, libpostalDefaultFuzzyOptions)
+}
+
+func IsStreetDuplicateFuzzyOptionsE(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64, options FuzzyDuplicateOptions) (FuzzyDuplicateResult, error) {
+    return isDuplicateFuzzy("neardupe.IsStreetDuplicateFuzzy", tokens1, scores1, tokens2, scores2, options, func(cNumTokens1 C.size_t, cTokens1 **C.char, cScores1 *C.double, cNumTokens2 C.size_t, cTokens2 **C.char, cScores2 *C.double, cOptions C.libpostal_fuzzy_duplicate_options_t) C.libpostal_fuzzy_duplicate_status_t {
+        return C.libpostal_is_street_duplicate_fuzzy(cNumTokens1, cTokens1, cScores1, cNumTokens2, cTokens2, cScores2, cOptions)
+    })
+}
+
+func IsStreetDuplicateFuzzyOptions(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64, options FuzzyDuplicateOptions) FuzzyDuplicateResult {
+    result, _ := IsStreetDuplicateFuzzyOptionsE(tokens1, scores1, tokens2, scores2, options)
+    return result
+}
+
+func IsStreetDuplicateFuzzy(tokens1 []string, scores1 []float64, tokens2 []string, scores2 []float64) FuzzyDuplicateResult {
+    return IsStreetDuplicateFuzzyOptions(tokens1, scores1, tokens2, scores2, libpostalDefaultFuzzyOptions)
+}
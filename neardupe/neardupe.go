@@ -9,18 +9,47 @@ package postal
 import "C"
 
 import (
-	"log"
-	"sync"
+	"context"
 	"unicode/utf8"
 	"unsafe"
+
+	"github.com/openvenues/gopostal/internal/cstrings"
+	"github.com/openvenues/gopostal/internal/errs"
+	"github.com/openvenues/gopostal/internal/hooks"
+	"github.com/openvenues/gopostal/internal/lifecycle"
+	label "github.com/openvenues/gopostal/label"
+)
+
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrLengthMismatch = errs.ErrLengthMismatch
+    ErrEmptyInput = errs.ErrEmptyInput
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+    ErrInvalidLabel = errs.ErrInvalidLabel
 )
 
-var mu sync.Mutex
+type Config = lifecycle.Config
 
-func init() {
-    if (!bool(C.libpostal_setup()) || !bool(C.libpostal_setup_language_classifier())) {
-        log.Fatal("Could not load libpostal")
-    }
+var libpostal = lifecycle.NewHandle(lifecycle.Core | lifecycle.LanguageClassifier)
+
+// Setup loads libpostal's core data and language classifier using the
+// directories in config. Calling it is optional; otherwise they are loaded on
+// first use, honoring $GOPOSTAL_DATADIR.
+func Setup(config Config) error {
+    return libpostal.Setup(config)
+}
+
+// Teardown unloads the data files loaded by Setup or on first use, unless
+// another package still uses them.
+func Teardown() {
+    libpostal.Teardown()
+}
+
+// Loaded reports whether the data files the package uses are loaded. They are
+// loaded on first use, and unloaded after Config.IdleTimeout without use.
+func Loaded() bool {
+    return libpostal.Loaded()
 }
 
 type NormalizeOptions struct {
@@ -109,38 +138,30 @@ func GetDefaultNearDupeHashOptions() NearDupeHashOptions {
 var libpostalDefaultOptions = GetDefaultNormalizeOptions()
 var libpostalDefaultHashOptions = GetDefaultNearDupeHashOptions()
 
-func NearDupeNameOptions(name string, options NormalizeOptions) []string {
+func NearDupeNameOptionsE(name string, options NormalizeOptions) (hashes []string, err error) {
+    call := hooks.Start("neardupe.NearDupeName", len(name))
+    defer func() { call.Done(len(hashes), err) }()
+
     if !utf8.ValidString(name) {
-        return nil
+        return nil, ErrInvalidUTF8
     }
 
-	mu.Lock()
-	defer mu.Unlock()
+	call.Lock()
+	defer lifecycle.Unlock()
+
+	if err := libpostal.Ensure(); err != nil {
+		return nil, err
+	}
 
 	cName := C.CString(name)
 	defer C.free(unsafe.Pointer(cName))
 
-    var char_ptr *C.char
-    ptr_size := unsafe.Sizeof(char_ptr)
+    cLanguages := cstrings.NewArray(options.Languages)
+    defer cLanguages.Free()
 
     cOptions := C.libpostal_get_default_options()
-    if options.Languages != nil {
-        cLanguages := C.calloc(C.size_t(len(options.Languages)), C.size_t(ptr_size))
-        cLanguagesPtr := (*[1<<30](*C.char))(unsafe.Pointer(cLanguages))
-
-        defer C.free(unsafe.Pointer(cLanguages))
-
-        for i := 0; i < len(options.Languages); i++ {
-            cLang := C.CString(options.Languages[i])
-            defer C.free(unsafe.Pointer(cLang))
-            cLanguagesPtr[i] = cLang
-        }
-
-        cOptions.languages = (**C.char)(cLanguages)
-        cOptions.num_languages = C.size_t(len(options.Languages))
-    } else {
-        cOptions.num_languages = 0
-    }
+    cOptions.languages = (**C.char)(cLanguages.Pointer())
+    cOptions.num_languages = C.size_t(cLanguages.Len())
 
     cOptions.address_components = C.uint16_t(options.AddressComponents)
     cOptions.latin_ascii = C.bool(options.LatinAscii)
@@ -164,28 +185,79 @@ func NearDupeNameOptions(name string, options NormalizeOptions) []string {
 	var cNumHashes = C.size_t(0)
 
 	cHashes := C.libpostal_near_dupe_name_hashes(cName, cOptions, &cNumHashes)
-	defer C.free(unsafe.Pointer(cHashes))
+	if cHashes == nil {
+		return nil, ErrLibpostal
+	}
+	defer C.libpostal_expansion_array_destroy(cHashes, cNumHashes)
 
-	return cStringArrayToStringSlice(cHashes, cNumHashes)
+	return cStringArrayToStringSlice(cHashes, cNumHashes), nil
+}
+
+func NearDupeNameOptions(name string, options NormalizeOptions) []string {
+	hashes, _ := NearDupeNameOptionsE(name, options)
+	return hashes
 }
 
 func NearDupeNames(name string) ([]string) {
 	return NearDupeNameOptions(name, libpostalDefaultOptions)
 }
 
-func NearDupeOptions(labels []string, values []string, options NearDupeHashOptions, languages []string) []string {
+// inputLen returns the total length of the strings in lists, as reported to
+// observers.
+func inputLen(lists ...[]string) int {
+    n := 0
+    for _, list := range lists {
+        for _, s := range list {
+            n += len(s)
+        }
+    }
+    return n
+}
+
+// checkComponents validates parallel label/value slices before they are
+// handed to libpostal.
+func checkComponents(labels []string, values []string) error {
     if len(labels) != len(values) {
-        return nil
+        return ErrLengthMismatch
     }
 
-    mu.Lock()
-    defer mu.Unlock()
+    if len(labels) == 0 {
+        return ErrEmptyInput
+    }
 
-    numComponents := len(labels)
-    if numComponents == 0 {
-        return nil
+    for i := 0; i < len(labels); i++ {
+        if !utf8.ValidString(labels[i]) || !utf8.ValidString(values[i]) {
+            return ErrInvalidUTF8
+        }
     }
 
+    // libpostal ignores labels it doesn't know, so a typo would silently
+    // change the hashes.
+    return label.Validate(labels)
+}
+
+// NearDupeContext is NearDupeOptionsE, but gives up waiting for other calls
+// into libpostal and returns ctx.Err() if ctx is done first. Once libpostal
+// starts hashing, it runs to completion.
+func NearDupeContext(ctx context.Context, labels []string, values []string, options NearDupeHashOptions, languages []string) (hashes []string, err error) {
+    call := hooks.Start("neardupe.NearDupe", inputLen(labels, values))
+    defer func() { call.Done(len(hashes), err) }()
+
+    if err := checkComponents(labels, values); err != nil {
+        return nil, err
+    }
+
+    if err := call.LockContext(ctx); err != nil {
+        return nil, err
+    }
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
+    }
+
+    numComponents := len(labels)
+
     cLabels := make([]*C.char, numComponents)
     cValues := make([]*C.char, numComponents)
 
@@ -216,19 +288,16 @@ func NearDupeOptions(labels []string, values []string, options NearDupeHashOptio
     var cHashes **C.char
 
     if len(languages) > 0 {
-        cLanguages := make([]*C.char, len(languages))
-        for i, lang := range languages {
-            cLanguages[i] = C.CString(lang)
-            defer C.free(unsafe.Pointer(cLanguages[i]))
-        }
+        cLanguages := cstrings.NewArray(languages)
+        defer cLanguages.Free()
 
         cHashes = C.libpostal_near_dupe_hashes_languages(
             C.size_t(numComponents),
             (**C.char)(unsafe.Pointer(&cLabels[0])),
             (**C.char)(unsafe.Pointer(&cValues[0])),
             cOptions,
-            C.size_t(len(languages)),
-            (**C.char)(unsafe.Pointer(&cLanguages[0])),
+            C.size_t(cLanguages.Len()),
+            (**C.char)(cLanguages.Pointer()),
             &cNumHashes,
         )
     } else {
@@ -240,9 +309,22 @@ func NearDupeOptions(labels []string, values []string, options NearDupeHashOptio
             &cNumHashes,
         )
     }
-    defer C.free(unsafe.Pointer(cHashes))
 
-    return cStringArrayToStringSlice(cHashes, cNumHashes)
+    if cHashes == nil {
+        return nil, ErrLibpostal
+    }
+    defer C.libpostal_expansion_array_destroy(cHashes, cNumHashes)
+
+    return cStringArrayToStringSlice(cHashes, cNumHashes), nil
+}
+
+func NearDupeOptionsE(labels []string, values []string, options NearDupeHashOptions, languages []string) ([]string, error) {
+    return NearDupeContext(context.Background(), labels, values, options, languages)
+}
+
+func NearDupeOptions(labels []string, values []string, options NearDupeHashOptions, languages []string) []string {
+    hashes, _ := NearDupeOptionsE(labels, values, options, languages)
+    return hashes
 }
 
 func NearDupe(labels []string, values []string, options NearDupeHashOptions) []string {
@@ -257,19 +339,23 @@ func NearDupeLanguages(labels []string, values []string, options NearDupeHashOpt
     return NearDupeOptions(labels, values, options, languages)
 }
 
-func PlaceLanguages(labels []string, values []string) []string {
-    if len(labels) != len(values) {
-        return nil
+func PlaceLanguagesE(labels []string, values []string) (languages []string, err error) {
+    call := hooks.Start("neardupe.PlaceLanguages", inputLen(labels, values))
+    defer func() { call.Done(len(languages), err) }()
+
+    if err := checkComponents(labels, values); err != nil {
+        return nil, err
     }
 
-    mu.Lock()
-    defer mu.Unlock()
+    call.Lock()
+    defer lifecycle.Unlock()
 
-    numComponents := len(labels)
-    if numComponents == 0 {
-        return nil
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
     }
 
+    numComponents := len(labels)
+
 	cLabels := make([]*C.char, numComponents)
 	cValues := make([]*C.char, numComponents)
 
@@ -288,25 +374,26 @@ func PlaceLanguages(labels []string, values []string) []string {
 		(**C.char)(unsafe.Pointer(&cValues[0])),
 		&cNumLanguages,
 	)
-	defer C.free(unsafe.Pointer(cLanguages))
+	if cLanguages == nil {
+		return nil, ErrLibpostal
+	}
+	// The languages array is allocated like an expansion array.
+	defer C.libpostal_expansion_array_destroy(cLanguages, cNumLanguages)
 
-	return cStringArrayToStringSlice(cLanguages, cNumLanguages)
+	return cStringArrayToStringSlice(cLanguages, cNumLanguages), nil
 }
 
+func PlaceLanguages(labels []string, values []string) []string {
+	languages, _ := PlaceLanguagesE(labels, values)
+	return languages
+}
+
+// cStringArrayToStringSlice copies a char ** result into Go. The caller still
+// owns the C array and its strings.
 func cStringArrayToStringSlice(cArray **C.char, arraySize C.size_t) []string {
-    slice := make([]string, int(arraySize))
-    cArrayPtr := (*[1<<30](*C.char))(unsafe.Pointer(cArray))
-    
-    var i uint64
-    for i = 0; i < uint64(arraySize); i++ {
-        slice[i] = C.GoString(cArrayPtr[i])
-    }
-    return slice
+    return cstrings.GoStrings(unsafe.Pointer(cArray), int(arraySize))
 }
 
 func NearDupeTeardown() {
-    mu.Lock()
-    defer mu.Unlock()
-    C.libpostal_teardown()
-    C.libpostal_teardown_language_classifier()
+    Teardown()
 }
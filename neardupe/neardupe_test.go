@@ -1,8 +1,14 @@
 package postal
 
 import (
+	"context"
+	"errors"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/openvenues/gopostal/internal/lifecycle"
+	parser "github.com/openvenues/gopostal/parser"
 )
 
 func TestNearDupeHashes(t *testing.T) {
@@ -662,4 +668,289 @@ func TestNearDupeNameHashes(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+func TestIsDuplicate(t *testing.T) {
+	testCases := []struct {
+		name           string
+		isDuplicate    func(string, string) DuplicateStatus
+		value1         string
+		value2         string
+		expectedStatus DuplicateStatus
+	}{
+		{"Same name, different case", IsNameDuplicate, "Brooklyn Public Library", "brooklyn public library", ExactDuplicate},
+		{"Different names", IsNameDuplicate, "Brooklyn Public Library", "Central Park", NonDuplicate},
+		{"Street abbreviation", IsStreetDuplicate, "Park Ave", "Park Avenue", ExactDuplicate},
+		{"Different streets", IsStreetDuplicate, "Park Ave", "Main St", NonDuplicate},
+		{"Same house number", IsHouseNumberDuplicate, "123", "123", ExactDuplicate},
+		{"Different house numbers", IsHouseNumberDuplicate, "123", "124", NonDuplicate},
+		{"PO box punctuation", IsPoBoxDuplicate, "PO Box 1234", "P.O. Box 1234", ExactDuplicate},
+		{"Unit abbreviation", IsUnitDuplicate, "Apt 3", "Apartment 3", ExactDuplicate},
+		{"Floor abbreviation", IsFloorDuplicate, "Fl 2", "Floor 2", ExactDuplicate},
+		{"Same postal code", IsPostalCodeDuplicate, "11216", "11216", ExactDuplicate},
+		{"Different postal codes", IsPostalCodeDuplicate, "11216", "11217", NonDuplicate},
+		{"Invalid UTF-8", IsNameDuplicate, "\xff", "Central Park", NullDuplicate},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status := tc.isDuplicate(tc.value1, tc.value2)
+			if status != tc.expectedStatus {
+				t.Errorf("unexpected status for %q, %q.\nGot:  %s\nWant: %s", tc.value1, tc.value2, status, tc.expectedStatus)
+			}
+		})
+	}
+}
+
+func TestIsDuplicateLanguages(t *testing.T) {
+	options := GetDefaultNormalizeOptions()
+	options.Languages = []string{"de"}
+
+	if status := IsStreetDuplicateOptions("Hauptstr.", "Hauptstraße", options); status != ExactDuplicate {
+		t.Errorf("unexpected status.\nGot:  %s\nWant: %s", status, ExactDuplicate)
+	}
+}
+
+func TestIsToponymDuplicate(t *testing.T) {
+	labels := []string{"city", "state"}
+
+	status := IsToponymDuplicate(labels, []string{"Brooklyn", "NY"}, labels, []string{"brooklyn", "ny"})
+	if status != ExactDuplicate {
+		t.Errorf("unexpected status.\nGot:  %s\nWant: %s", status, ExactDuplicate)
+	}
+
+	status = IsToponymDuplicate(labels, []string{"Brooklyn"}, labels, []string{"Brooklyn", "NY"})
+	if status != NullDuplicate {
+		t.Errorf("unexpected status for mismatched lengths.\nGot:  %s\nWant: %s", status, NullDuplicate)
+	}
+
+	status = IsToponymDuplicate(labels, []string{"Brooklyn", "NY"}, labels, []string{"Brooklyn", "NY \xff"})
+	if status != NullDuplicate {
+		t.Errorf("unexpected status for invalid UTF-8.\nGot:  %s\nWant: %s", status, NullDuplicate)
+	}
+
+	status = IsToponymDuplicate([]string{"town", "state"}, []string{"Brooklyn", "NY"}, labels, []string{"Brooklyn", "NY"})
+	if status != NullDuplicate {
+		t.Errorf("unexpected status for an invalid label.\nGot:  %s\nWant: %s", status, NullDuplicate)
+	}
+}
+
+func TestIsDuplicateFuzzy(t *testing.T) {
+	tokens1 := []string{"joe's", "pizza", "brooklyn"}
+	scores1 := []float64{0.7, 0.2, 0.1}
+	tokens2 := []string{"joe's", "pizza"}
+	scores2 := []float64{0.7, 0.2}
+
+	result := IsNameDuplicateFuzzy(tokens1, scores1, tokens2, scores2)
+	if result.Status < PossibleDuplicate {
+		t.Errorf("unexpected status for overlapping names: %s (similarity %f)", result.Status, result.Similarity)
+	}
+	if result.Similarity <= 0 || result.Similarity > 1 {
+		t.Errorf("similarity out of range: %f", result.Similarity)
+	}
+
+	result = IsNameDuplicateFuzzy([]string{"joe's", "pizza"}, scores2, []string{"central", "park"}, scores2)
+	if result.Status != NonDuplicate {
+		t.Errorf("unexpected status for distinct names.\nGot:  %s\nWant: %s", result.Status, NonDuplicate)
+	}
+
+	options := GetDefaultFuzzyDuplicateOptions()
+	options.Languages = []string{"en"}
+
+	result = IsStreetDuplicateFuzzyOptions([]string{"park", "ave"}, []float64{0.9, 0.1}, []string{"park", "avenue"}, []float64{0.9, 0.1}, options)
+	if result.Status < LikelyDuplicate {
+		t.Errorf("unexpected status for street abbreviation: %s (similarity %f)", result.Status, result.Similarity)
+	}
+
+	result = IsNameDuplicateFuzzy(tokens1, scores2, tokens2, scores2)
+	if result.Status != NullDuplicate {
+		t.Errorf("unexpected status for mismatched scores.\nGot:  %s\nWant: %s", result.Status, NullDuplicate)
+	}
+}
+
+func TestComponents(t *testing.T) {
+	components := []parser.ParsedComponent{
+		{Label: "house", Value: "Brooklyn Public Library"},
+		{Label: "category", Value: "library"},
+		{Label: "house_number", Value: "10"},
+		{Label: "road", Value: "grand army"},
+		{Label: "unit", Value: "#2"},
+		{Label: "road", Value: "plaza"},
+		{Label: "near", Value: "prospect park"},
+		{Label: "city", Value: " "},
+		{Label: "postcode", Value: "11238"},
+		{Label: "unknown", Value: "x"},
+	}
+
+	labels, values := Components(components)
+
+	expectedLabels := []string{"house", "house_number", "road", "unit", "postcode"}
+	expectedValues := []string{"Brooklyn Public Library", "10", "grand army plaza", "#2", "11238"}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("labels != expected: %v != %v", labels, expectedLabels)
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Errorf("values != expected: %v != %v", values, expectedValues)
+	}
+}
+
+func TestNearDupeFromParsed(t *testing.T) {
+	options := GetDefaultNearDupeHashOptions()
+	options.WithAddress = true
+
+	components := []parser.ParsedComponent{
+		{Label: "house_number", Value: "781"},
+		{Label: "road", Value: "franklin ave"},
+		{Label: "near", Value: "prospect park"},
+		{Label: "city", Value: "brooklyn"},
+		{Label: "postcode", Value: "11216"},
+	}
+	expected := NearDupe([]string{"house_number", "road", "city", "postcode"}, []string{"781", "franklin ave", "brooklyn", "11216"}, options)
+
+	if hashes := NearDupeFromParsed(components, options); !reflect.DeepEqual(hashes, expected) {
+		t.Errorf("hashes != expected: %v != %v", hashes, expected)
+	}
+
+	if _, err := NearDupeFromParsedE([]parser.ParsedComponent{{Label: "near", Value: "prospect park"}}, options); !errors.Is(err, ErrEmptyInput) {
+		t.Errorf("expected %v, got %v", ErrEmptyInput, err)
+	}
+}
+
+func TestNearDupeFromText(t *testing.T) {
+	options := GetDefaultNearDupeHashOptions()
+	options.WithAddress = true
+
+	address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+	parserOptions := parser.ParserOptions{Language: "en", Country: "us"}
+
+	labels, values := Components(parser.ParseAddressOptions(address, parserOptions))
+	expected := NearDupeLanguages(labels, values, options, []string{"en"})
+
+	hashes, err := NearDupeFromTextE(address, parserOptions, options)
+	if err != nil {
+		t.Fatal("unexpected error: " + err.Error())
+	}
+	if !reflect.DeepEqual(hashes, expected) {
+		t.Errorf("hashes != expected: %v != %v", hashes, expected)
+	}
+
+	if _, err := NearDupeFromTextE("\xff", parserOptions, options); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("expected %v, got %v", ErrInvalidUTF8, err)
+	}
+}
+
+func TestNearDupeErrors(t *testing.T) {
+	options := GetDefaultNearDupeHashOptions()
+
+	testCases := []struct {
+		name        string
+		labels      []string
+		values      []string
+		expectedErr error
+	}{
+		{"Length mismatch", []string{"house_number", "road"}, []string{"123"}, ErrLengthMismatch},
+		{"Empty input", []string{}, []string{}, ErrEmptyInput},
+		{"Invalid UTF-8", []string{"road"}, []string{"Main St \xff"}, ErrInvalidUTF8},
+		{"Invalid label", []string{"house_num", "road"}, []string{"123", "Main St"}, ErrInvalidLabel},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hashes, err := NearDupeOptionsE(tc.labels, tc.values, options, nil)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("NearDupeOptionsE: expected %v, got %v", tc.expectedErr, err)
+			}
+			if hashes != nil {
+				t.Errorf("NearDupeOptionsE: expected nil hashes, got %v", hashes)
+			}
+
+			languages, err := PlaceLanguagesE(tc.labels, tc.values)
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("PlaceLanguagesE: expected %v, got %v", tc.expectedErr, err)
+			}
+			if languages != nil {
+				t.Errorf("PlaceLanguagesE: expected nil languages, got %v", languages)
+			}
+		})
+	}
+
+	if _, err := NearDupeNameOptionsE("\xff", GetDefaultNormalizeOptions()); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("NearDupeNameOptionsE: expected %v, got %v", ErrInvalidUTF8, err)
+	}
+}
+
+func TestIsDuplicateErrors(t *testing.T) {
+	options := GetDefaultNormalizeOptions()
+	fuzzyOptions := GetDefaultFuzzyDuplicateOptions()
+	labels := []string{"city", "state"}
+	values := []string{"Brooklyn", "NY"}
+
+	testCases := []struct {
+		name        string
+		isDuplicate func() (DuplicateStatus, error)
+		expectedErr error
+	}{
+		{"Invalid UTF-8", func() (DuplicateStatus, error) {
+			return IsStreetDuplicateOptionsE("Main St \xff", "Main Street", options)
+		}, ErrInvalidUTF8},
+		{"Toponym length mismatch", func() (DuplicateStatus, error) {
+			return IsToponymDuplicateOptionsE(labels, values[:1], labels, values, options)
+		}, ErrLengthMismatch},
+		{"Toponym empty input", func() (DuplicateStatus, error) {
+			return IsToponymDuplicateOptionsE(nil, nil, labels, values, options)
+		}, ErrEmptyInput},
+		{"Toponym invalid UTF-8", func() (DuplicateStatus, error) {
+			return IsToponymDuplicateOptionsE(labels, values, labels, []string{"Brooklyn", "NY \xff"}, options)
+		}, ErrInvalidUTF8},
+		{"Toponym invalid label", func() (DuplicateStatus, error) {
+			return IsToponymDuplicateOptionsE([]string{"town", "state"}, values, labels, values, options)
+		}, ErrInvalidLabel},
+		{"Fuzzy length mismatch", func() (DuplicateStatus, error) {
+			result, err := IsNameDuplicateFuzzyOptionsE([]string{"pizza"}, nil, []string{"pizza"}, []float64{1}, fuzzyOptions)
+			return result.Status, err
+		}, ErrLengthMismatch},
+		{"Fuzzy empty input", func() (DuplicateStatus, error) {
+			result, err := IsStreetDuplicateFuzzyOptionsE(nil, nil, []string{"main"}, []float64{1}, fuzzyOptions)
+			return result.Status, err
+		}, ErrEmptyInput},
+		{"Fuzzy invalid UTF-8", func() (DuplicateStatus, error) {
+			result, err := IsNameDuplicateFuzzyOptionsE([]string{"\xff"}, []float64{1}, []string{"pizza"}, []float64{1}, fuzzyOptions)
+			return result.Status, err
+		}, ErrInvalidUTF8},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			status, err := tc.isDuplicate()
+			if !errors.Is(err, tc.expectedErr) {
+				t.Errorf("expected %v, got %v", tc.expectedErr, err)
+			}
+			if status != NullDuplicate {
+				t.Errorf("expected %s, got %s", NullDuplicate, status)
+			}
+		})
+	}
+
+	if _, err := IsPostalCodeDuplicateOptionsE("11216", "11216", options); err != nil {
+		t.Error("unexpected error: " + err.Error())
+	}
+}
+
+func TestNearDupeContext(t *testing.T) {
+	labels := []string{"house_number", "road"}
+	values := []string{"123", "Main St"}
+
+	lifecycle.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := NearDupeContext(ctx, labels, values, GetDefaultNearDupeHashOptions(), nil)
+	lifecycle.Unlock()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	if _, err := NearDupeContext(context.Background(), labels, values, GetDefaultNearDupeHashOptions(), nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
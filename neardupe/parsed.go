@@ -0,0 +1,77 @@
+package postal
+
+import (
+    "strings"
+
+    label "github.com/openvenues/gopostal/label"
+    parser "github.com/openvenues/gopostal/parser"
+)
+
+// Labels the parser emits that libpostal ignores when hashing.
+var unhashedLabels = map[label.Label]bool{
+    label.Category: true,
+    label.Near: true,
+}
+
+// Components converts parser output to the parallel labels and values taken by
+// NearDupe. Components libpostal doesn't hash, or with labels it doesn't know,
+// are dropped. A label that appears more than once keeps its first position,
+// with its values joined by spaces, as when the parser splits a road around a
+// unit.
+func Components(components []parser.ParsedComponent) ([]string, []string) {
+    var labels, values []string
+    index := make(map[label.Label]int)
+
+    for _, component := range components {
+        if unhashedLabels[component.Label] || !component.Label.IsValid() {
+            continue
+        }
+        value := strings.TrimSpace(component.Value)
+        if value == "" {
+            continue
+        }
+
+        if i, ok := index[component.Label]; ok {
+            values[i] += " " + value
+            continue
+        }
+        index[component.Label] = len(labels)
+        labels = append(labels, string(component.Label))
+        values = append(values, value)
+    }
+
+    return labels, values
+}
+
+func NearDupeFromParsedE(components []parser.ParsedComponent, options NearDupeHashOptions) ([]string, error) {
+    labels, values := Components(components)
+    return NearDupeOptionsE(labels, values, options, nil)
+}
+
+// NearDupeFromParsed hashes parser output, converted with Components.
+func NearDupeFromParsed(components []parser.ParsedComponent, options NearDupeHashOptions) []string {
+    hashes, _ := NearDupeFromParsedE(components, options)
+    return hashes
+}
+
+// NearDupeFromTextE parses address with parserOptions and hashes the result.
+// If parserOptions.Language is set, it is also used as the hashing language.
+func NearDupeFromTextE(address string, parserOptions parser.ParserOptions, options NearDupeHashOptions) ([]string, error) {
+    components, err := parser.ParseAddressOptionsE(address, parserOptions)
+    if err != nil {
+        return nil, err
+    }
+
+    var languages []string
+    if parserOptions.Language != "" {
+        languages = []string{parserOptions.Language}
+    }
+
+    labels, values := Components(components)
+    return NearDupeOptionsE(labels, values, options, languages)
+}
+
+func NearDupeFromText(address string, parserOptions parser.ParserOptions, options NearDupeHashOptions) []string {
+    hashes, _ := NearDupeFromTextE(address, parserOptions, options)
+    return hashes
+}
@@ -0,0 +1,206 @@
+package postal
+
+/*
+#cgo pkg-config: libpostal
+#include <libpostal/libpostal.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "unicode/utf8"
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/cstrings"
+    "github.com/openvenues/gopostal/internal/errs"
+    "github.com/openvenues/gopostal/internal/lifecycle"
+    tokenize "github.com/openvenues/gopostal/tokenize"
+)
+
+type Config = lifecycle.Config
+
+var libpostal = lifecycle.NewHandle(lifecycle.Core)
+
+// Setup loads libpostal's core data using the directories in config. Calling it
+// is optional; otherwise the data is loaded on first use, honoring
+// $GOPOSTAL_DATADIR.
+func Setup(config Config) error {
+    return libpostal.Setup(config)
+}
+
+// Teardown unloads the data files loaded by Setup or on first use, unless
+// another package still uses them.
+func Teardown() {
+    libpostal.Teardown()
+}
+
+// Loaded reports whether the data files the package uses are loaded. They are
+// loaded on first use, and unloaded after Config.IdleTimeout without use.
+func Loaded() bool {
+    return libpostal.Loaded()
+}
+
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+)
+
+type StringOptions uint64
+
+const (
+    StringLatinAscii StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_LATIN_ASCII
+    StringTransliterate StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_TRANSLITERATE
+    StringStripAccents StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_STRIP_ACCENTS
+    StringDecompose StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_DECOMPOSE
+    StringLowercase StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_LOWERCASE
+    StringTrim StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_TRIM
+    StringReplaceHyphens StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_REPLACE_HYPHENS
+    StringCompose StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_COMPOSE
+    StringSimpleLatinAscii StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_SIMPLE_LATIN_ASCII
+    StringReplaceNumex StringOptions = C.LIBPOSTAL_NORMALIZE_STRING_REPLACE_NUMEX
+
+    DefaultStringOptions StringOptions = C.LIBPOSTAL_NORMALIZE_DEFAULT_STRING_OPTIONS
+)
+
+type TokenOptions uint64
+
+const (
+    TokenReplaceHyphens TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_REPLACE_HYPHENS
+    TokenDeleteHyphens TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_DELETE_HYPHENS
+    TokenDeleteFinalPeriod TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_DELETE_FINAL_PERIOD
+    TokenDeleteAcronymPeriods TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_DELETE_ACRONYM_PERIODS
+    TokenDropEnglishPossessives TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_DROP_ENGLISH_POSSESSIVES
+    TokenDeleteOtherApostrophe TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_DELETE_OTHER_APOSTROPHE
+    TokenSplitAlphaFromNumeric TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_SPLIT_ALPHA_FROM_NUMERIC
+    TokenReplaceDigits TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_REPLACE_DIGITS
+    TokenReplaceNumericTokenLetters TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_REPLACE_NUMERIC_TOKEN_LETTERS
+    TokenReplaceNumericHyphens TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_REPLACE_NUMERIC_HYPHENS
+
+    DefaultTokenOptions TokenOptions = C.LIBPOSTAL_NORMALIZE_DEFAULT_TOKEN_OPTIONS
+    TokenOptionsDropPeriods TokenOptions = C.LIBPOSTAL_NORMALIZE_TOKEN_OPTIONS_DROP_PERIODS
+    DefaultTokenOptionsNumeric TokenOptions = C.LIBPOSTAL_NORMALIZE_DEFAULT_TOKEN_OPTIONS_NUMERIC
+)
+
+type NormalizedToken struct {
+    Str string `json:"str"`
+    Token tokenize.Token `json:"token"`
+}
+
+type NormalizerOptions struct {
+    Languages []string
+    StringOptions StringOptions
+    TokenOptions TokenOptions
+    Whitespace bool
+}
+
+func GetDefaultNormalizerOptions() NormalizerOptions {
+    return NormalizerOptions{
+        Languages: nil,
+        StringOptions: DefaultStringOptions,
+        TokenOptions: DefaultTokenOptions,
+        Whitespace: false,
+    }
+}
+
+var normalizerDefaultOptions = GetDefaultNormalizerOptions()
+
+func NormalizedTokensOptions(input string, options NormalizerOptions) ([]NormalizedToken, error) {
+    if !utf8.ValidString(input) {
+        return nil, ErrInvalidUTF8
+    }
+
+    lifecycle.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
+    }
+
+    cInput := C.CString(input)
+    defer C.free(unsafe.Pointer(cInput))
+
+    var cNumTokens = C.size_t(0)
+    var cTokens *C.libpostal_normalized_token_t
+
+    cStringOptions := C.uint64_t(options.StringOptions)
+    cTokenOptions := C.uint64_t(options.TokenOptions)
+    cWhitespace := C.bool(options.Whitespace)
+
+    if len(options.Languages) > 0 {
+        cLanguages := cstrings.NewArray(options.Languages)
+        defer cLanguages.Free()
+
+        cTokens = C.libpostal_normalized_tokens_languages(cInput, cStringOptions, cTokenOptions, cWhitespace, C.size_t(cLanguages.Len()), (**C.char)(cLanguages.Pointer()), &cNumTokens)
+    } else {
+        cTokens = C.libpostal_normalized_tokens(cInput, cStringOptions, cTokenOptions, cWhitespace, &cNumTokens)
+    }
+
+    if cTokens == nil {
+        return []NormalizedToken{}, nil
+    }
+    defer C.free(unsafe.Pointer(cTokens))
+
+    numTokens := uint64(cNumTokens)
+
+    tokens := make([]NormalizedToken, numTokens)
+    if numTokens == 0 {
+        return tokens, nil
+    }
+
+    // Accessing a C array
+    cTokensPtr := (*[1<<26]C.libpostal_normalized_token_t)(unsafe.Pointer(cTokens))[:numTokens:numTokens]
+
+    var i uint64
+    for i = 0; i < numTokens; i++ {
+        tokens[i] = NormalizedToken{
+            Str: C.GoString(cTokensPtr[i].str),
+            Token: tokenize.Token{
+                Offset: int(cTokensPtr[i].token.offset),
+                Length: int(cTokensPtr[i].token.len),
+                Type: tokenize.TokenType(cTokensPtr[i].token._type),
+            },
+        }
+        C.free(unsafe.Pointer(cTokensPtr[i].str))
+    }
+
+    return tokens, nil
+}
+
+func NormalizedTokens(input string) ([]NormalizedToken, error) {
+    return NormalizedTokensOptions(input, normalizerDefaultOptions)
+}
+
+func NormalizeString(s string, flags StringOptions, languages []string) (string, error) {
+    if !utf8.ValidString(s) {
+        return "", ErrInvalidUTF8
+    }
+
+    lifecycle.Lock()
+    defer lifecycle.Unlock()
+
+    if err := libpostal.Ensure(); err != nil {
+        return "", err
+    }
+
+    cInput := C.CString(s)
+    defer C.free(unsafe.Pointer(cInput))
+
+    var cNormalized *C.char
+
+    if len(languages) > 0 {
+        cLanguages := cstrings.NewArray(languages)
+        defer cLanguages.Free()
+
+        cNormalized = C.libpostal_normalize_string_languages(cInput, C.uint64_t(flags), C.size_t(cLanguages.Len()), (**C.char)(cLanguages.Pointer()))
+    } else {
+        cNormalized = C.libpostal_normalize_string(cInput, C.uint64_t(flags))
+    }
+
+    if cNormalized == nil {
+        return "", ErrLibpostal
+    }
+    defer C.free(unsafe.Pointer(cNormalized))
+
+    return C.GoString(cNormalized), nil
+}
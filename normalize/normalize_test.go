@@ -0,0 +1,90 @@
+package postal
+
+import (
+	"reflect"
+	"testing"
+
+	tokenize "github.com/openvenues/gopostal/tokenize"
+)
+
+func testNormalizedTokens(t *testing.T, input string, options NormalizerOptions, expectedStrs []string) []NormalizedToken {
+	tokens, err := NormalizedTokensOptions(input, options)
+	if err != nil {
+		t.Fatalf("NormalizedTokensOptions returned error: %v", err)
+	}
+
+	strs := make([]string, len(tokens))
+	for i, token := range tokens {
+		strs[i] = token.Str
+	}
+
+	if !reflect.DeepEqual(strs, expectedStrs) {
+		t.Errorf("normalized tokens != expected:\nGot:  %q\nWant: %q", strs, expectedStrs)
+	}
+
+	return tokens
+}
+
+func TestNormalizedTokensDefault(t *testing.T) {
+	tokens := testNormalizedTokens(t, "Friedrichstraße 128, Berlin", GetDefaultNormalizerOptions(),
+		[]string{"friedrichstrasse", "128", ",", "berlin"},
+	)
+
+	if len(tokens) == 4 {
+		if tokens[1].Token.Type != tokenize.TokenNumeric {
+			t.Errorf("expected numeric token, got %s", tokens[1].Token.Type)
+		}
+		if tokens[3].Token.Type != tokenize.TokenWord {
+			t.Errorf("expected word token, got %s", tokens[3].Token.Type)
+		}
+	}
+}
+
+func TestNormalizedTokensFlags(t *testing.T) {
+	options := GetDefaultNormalizerOptions()
+	options.StringOptions = StringLowercase | StringTrim
+	options.TokenOptions = TokenDeleteFinalPeriod
+
+	testNormalizedTokens(t, "Apt 3 Main St.", options, []string{"apt", "3", "main", "st"})
+
+	options.TokenOptions |= TokenReplaceDigits
+	testNormalizedTokens(t, "Apt 3 Main St.", options, []string{"apt", "D", "main", "st"})
+}
+
+func TestNormalizedTokensInvalidUTF8(t *testing.T) {
+	if _, err := NormalizedTokens("\xff"); err != ErrInvalidUTF8 {
+		t.Errorf("expected ErrInvalidUTF8, got %v", err)
+	}
+}
+
+func TestNormalizeString(t *testing.T) {
+	testCases := []struct {
+		name      string
+		input     string
+		flags     StringOptions
+		languages []string
+		expected  string
+	}{
+		{"Default options", "Café de Flore", DefaultStringOptions, nil, "cafe de flore"},
+		{"Lowercase only", "Café de Flore", StringLowercase, nil, "café de flore"},
+		{"Trim and lowercase", "  Whole Foods Market  ", StringLowercase | StringTrim, nil, "whole foods market"},
+		{"Hyphens with language", "Saint-Germain-des-Prés", DefaultStringOptions, []string{"fr"}, "saint germain des pres"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			normalized, err := NormalizeString(tc.input, tc.flags, tc.languages)
+			if err != nil {
+				t.Fatalf("NormalizeString returned error: %v", err)
+			}
+
+			if normalized != tc.expected {
+				t.Errorf("normalized != expected:\nGot:  %q\nWant: %q", normalized, tc.expected)
+			}
+		})
+	}
+
+	if _, err := NormalizeString("\xff", DefaultStringOptions, nil); err != ErrInvalidUTF8 {
+		t.Errorf("expected ErrInvalidUTF8, got %v", err)
+	}
+}
@@ -0,0 +1,31 @@
+package postal
+
+import (
+    "github.com/openvenues/gopostal/internal/hooks"
+)
+
+// Event describes one call into libpostal from the parser, expand or
+// neardupe packages. Calls that fail before reaching libpostal, e.g. on
+// invalid UTF-8, are reported with a zero LockWait and Duration.
+//
+// ParseAddresses and ExpandAddresses report one event per chunk of inputs
+// handled under a single acquisition of the lock, with InputLen and Results
+// summed over the chunk and Err set only if libpostal could not be loaded.
+type Event = hooks.Event
+
+// Observer receives an Event after each call returns. It is called from the
+// calling goroutine, so it must be safe for concurrent use and should be
+// fast.
+type Observer = hooks.Observer
+
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) {
+    f(e)
+}
+
+// SetObserver installs observer for all packages, replacing any previous one.
+// A nil observer turns observation off, which is the default.
+func SetObserver(observer Observer) {
+    hooks.SetObserver(observer)
+}
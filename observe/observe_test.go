@@ -0,0 +1,144 @@
+package postal
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	expand "github.com/openvenues/gopostal/expand"
+	"github.com/openvenues/gopostal/internal/lifecycle"
+	neardupe "github.com/openvenues/gopostal/neardupe"
+	parser "github.com/openvenues/gopostal/parser"
+)
+
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Observe(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) take() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func observe(t *testing.T) *recorder {
+	r := &recorder{}
+	SetObserver(r)
+	t.Cleanup(func() { SetObserver(nil) })
+	return r
+}
+
+func TestObserverOps(t *testing.T) {
+	r := observe(t)
+
+	address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+	components := parser.ParseAddress(address)
+	expansions := expand.ExpandAddress(address)
+	expand.ExpandAddressRoot(address)
+	hashes := neardupe.NearDupeDefaultOptions([]string{"house_number", "road"}, []string{"781", "Franklin Ave"})
+	neardupe.IsStreetDuplicate("Franklin Ave", "Franklin Avenue")
+	parser.ParseAddresses([]string{"781 Franklin Ave", "Brooklyn"}, parser.ParserOptions{})
+
+	expected := []struct {
+		op       string
+		inputLen int
+		results  int
+	}{
+		{"parser.ParseAddress", len(address), len(components)},
+		{"expand.ExpandAddress", len(address), len(expansions)},
+		{"expand.ExpandAddressRoot", len(address), -1},
+		{"neardupe.NearDupe", len("house_number") + len("road") + len("781") + len("Franklin Ave"), len(hashes)},
+		{"neardupe.IsStreetDuplicate", len("Franklin Ave") + len("Franklin Avenue"), 1},
+		{"parser.ParseAddresses", len("781 Franklin Ave") + len("Brooklyn"), -1},
+	}
+
+	events := r.take()
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d: %+v", len(expected), len(events), events)
+	}
+	for i, e := range expected {
+		event := events[i]
+		if event.Op != e.op || event.InputLen != e.inputLen {
+			t.Errorf("event %d: got %s with input length %d, want %s with %d", i, event.Op, event.InputLen, e.op, e.inputLen)
+		}
+		if e.results >= 0 && event.Results != e.results {
+			t.Errorf("%s: got %d results, want %d", event.Op, event.Results, e.results)
+		}
+		if event.Err != nil {
+			t.Errorf("%s: unexpected error %v", event.Op, event.Err)
+		}
+	}
+}
+
+func TestObserverLockWait(t *testing.T) {
+	r := observe(t)
+
+	lifecycle.Lock()
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		lifecycle.Unlock()
+	}()
+	parser.ParseAddress("781 Franklin Ave")
+
+	events := r.take()
+	if len(events) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(events))
+	}
+	if events[0].LockWait < 20*time.Millisecond {
+		t.Errorf("expected a lock wait of at least 20ms, got %v", events[0].LockWait)
+	}
+}
+
+func TestObserverErrors(t *testing.T) {
+	r := observe(t)
+
+	parser.ParseAddress("\xff")
+
+	lifecycle.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	expand.ExpandAddressContext(ctx, "781 Franklin Ave", expand.GetDefaultExpansionOptions())
+	lifecycle.Unlock()
+
+	events := r.take()
+	if len(events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events))
+	}
+
+	if !errors.Is(events[0].Err, parser.ErrInvalidUTF8) {
+		t.Errorf("expected ErrInvalidUTF8, got %v", events[0].Err)
+	}
+	if events[0].LockWait != 0 || events[0].Duration != 0 {
+		t.Errorf("expected no lock wait or duration before reaching libpostal, got %+v", events[0])
+	}
+
+	if !errors.Is(events[1].Err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", events[1].Err)
+	}
+	if events[1].LockWait < 10*time.Millisecond || events[1].Duration != 0 {
+		t.Errorf("expected only lock wait for an abandoned call, got %+v", events[1])
+	}
+}
+
+func TestObserverFunc(t *testing.T) {
+	var ops []string
+	SetObserver(ObserverFunc(func(e Event) { ops = append(ops, e.Op) }))
+	parser.ParseAddress("781 Franklin Ave")
+	SetObserver(nil)
+	parser.ParseAddress("781 Franklin Ave")
+
+	if len(ops) != 1 || ops[0] != "parser.ParseAddress" {
+		t.Errorf("unexpected ops: %v", ops)
+	}
+}
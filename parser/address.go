@@ -0,0 +1,142 @@
+package postal
+
+import (
+    label "github.com/openvenues/gopostal/label"
+)
+
+// Address holds parsed components by label. A label that occurs more than
+// once keeps its first value in its field, and the later values go in Extra
+// in the order they were parsed, along with any label Address has no field
+// for.
+type Address struct {
+    House string `json:"house,omitempty"`
+    Category string `json:"category,omitempty"`
+    Near string `json:"near,omitempty"`
+    HouseNumber string `json:"house_number,omitempty"`
+    Road string `json:"road,omitempty"`
+    Unit string `json:"unit,omitempty"`
+    Level string `json:"level,omitempty"`
+    Staircase string `json:"staircase,omitempty"`
+    Entrance string `json:"entrance,omitempty"`
+    PoBox string `json:"po_box,omitempty"`
+    Postcode string `json:"postcode,omitempty"`
+    Suburb string `json:"suburb,omitempty"`
+    CityDistrict string `json:"city_district,omitempty"`
+    City string `json:"city,omitempty"`
+    Island string `json:"island,omitempty"`
+    StateDistrict string `json:"state_district,omitempty"`
+    State string `json:"state,omitempty"`
+    CountryRegion string `json:"country_region,omitempty"`
+    Country string `json:"country,omitempty"`
+    WorldRegion string `json:"world_region,omitempty"`
+    Extra []ParsedComponent `json:"extra,omitempty"`
+}
+
+// Labels with a field in Address, in the order Components returns them.
+var addressLabels = []label.Label{
+    label.House,
+    label.Category,
+    label.Near,
+    label.HouseNumber,
+    label.Road,
+    label.Unit,
+    label.Level,
+    label.Staircase,
+    label.Entrance,
+    label.PoBox,
+    label.Postcode,
+    label.Suburb,
+    label.CityDistrict,
+    label.City,
+    label.Island,
+    label.StateDistrict,
+    label.State,
+    label.CountryRegion,
+    label.Country,
+    label.WorldRegion,
+}
+
+func (a *Address) field(l label.Label) *string {
+    switch l {
+    case label.House:
+        return &a.House
+    case label.Category:
+        return &a.Category
+    case label.Near:
+        return &a.Near
+    case label.HouseNumber:
+        return &a.HouseNumber
+    case label.Road:
+        return &a.Road
+    case label.Unit:
+        return &a.Unit
+    case label.Level:
+        return &a.Level
+    case label.Staircase:
+        return &a.Staircase
+    case label.Entrance:
+        return &a.Entrance
+    case label.PoBox:
+        return &a.PoBox
+    case label.Postcode:
+        return &a.Postcode
+    case label.Suburb:
+        return &a.Suburb
+    case label.CityDistrict:
+        return &a.CityDistrict
+    case label.City:
+        return &a.City
+    case label.Island:
+        return &a.Island
+    case label.StateDistrict:
+        return &a.StateDistrict
+    case label.State:
+        return &a.State
+    case label.CountryRegion:
+        return &a.CountryRegion
+    case label.Country:
+        return &a.Country
+    case label.WorldRegion:
+        return &a.WorldRegion
+    }
+    return nil
+}
+
+func NewAddress(components []ParsedComponent) Address {
+    var address Address
+    for _, component := range components {
+        field := address.field(component.Label)
+        if field != nil && *field == "" {
+            *field = component.Value
+        } else {
+            address.Extra = append(address.Extra, component)
+        }
+    }
+    return address
+}
+
+// Components returns the address as a slice, with the fields in the order of
+// addressLabels, from the most to the least specific, followed by Extra.
+// Empty fields are left out.
+func (a Address) Components() []ParsedComponent {
+    components := make([]ParsedComponent, 0, len(addressLabels)+len(a.Extra))
+    for _, l := range addressLabels {
+        if value := *a.field(l); value != "" {
+            components = append(components, ParsedComponent{Label: l, Value: value})
+        }
+    }
+    return append(components, a.Extra...)
+}
+
+// Get returns the first value for l, or "" if there is none.
+func (a Address) Get(l label.Label) string {
+    if field := a.field(l); field != nil && *field != "" {
+        return *field
+    }
+    for _, component := range a.Extra {
+        if component.Label == l {
+            return component.Value
+        }
+    }
+    return ""
+}
@@ -0,0 +1,58 @@
+package postal
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	format "github.com/openvenues/gopostal/format"
+)
+
+// The parse→format→parse round trips live here rather than in format, whose
+// own tests don't need libpostal.
+
+// componentValues returns the values of components by label, sorted, so that
+// addresses can be compared regardless of component order.
+func componentValues(components []ParsedComponent) map[string][]string {
+	values := make(map[string][]string)
+	for _, c := range components {
+		values[string(c.Label)] = append(values[string(c.Label)], c.Value)
+	}
+	for _, v := range values {
+		sort.Strings(v)
+	}
+	return values
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	testCases := []struct {
+		address string
+		country string
+	}{
+		{"781 Franklin Ave, Brooklyn, NY 11216", "us"},
+		{"Friedrichstraße 128, 10117 Berlin", "de"},
+		{"15 Rue de la Paix, 75002 Paris", "fr"},
+		{"10 Downing Street, London SW1A 2AA", "gb"},
+		{"〒150-0002 東京都渋谷区渋谷2丁目21-1", "jp"},
+		{"北京市东城区东长安街1号", "cn"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.country, func(t *testing.T) {
+			parserOptions := ParserOptions{Country: tc.country}
+			parsed := ParseAddressOptions(tc.address, parserOptions)
+
+			for _, singleLine := range []bool{false, true} {
+				formatted, err := format.FormatAddressOptionsE(LabelComponents(parsed), tc.country, format.FormatOptions{SingleLine: singleLine})
+				if err != nil {
+					t.Fatal("unexpected error: " + err.Error())
+				}
+
+				reparsed := ParseAddressOptions(formatted, parserOptions)
+				if got, expected := componentValues(reparsed), componentValues(parsed); !reflect.DeepEqual(got, expected) {
+					t.Errorf("%q parsed as %v, expected %v", formatted, got, expected)
+				}
+			}
+		})
+	}
+}
@@ -2,24 +2,53 @@ package postal
 
 /*
 #cgo pkg-config: libpostal
+#cgo CFLAGS: -I${SRCDIR}/../internal/cbuf
 #include <libpostal/libpostal.h>
 #include <stdlib.h>
+#include "cbuf.h"
 */
 import "C"
 
 import (
-    "log"
-    "sync"
+    "context"
+    "strings"
     "unsafe"
     "unicode/utf8"
+
+    "github.com/openvenues/gopostal/internal/cbuf"
+    "github.com/openvenues/gopostal/internal/errs"
+    "github.com/openvenues/gopostal/internal/hooks"
+    "github.com/openvenues/gopostal/internal/lifecycle"
+    label "github.com/openvenues/gopostal/label"
 )
 
-var mu sync.Mutex
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+)
 
-func init() {
-    if (!bool(C.libpostal_setup()) || !bool(C.libpostal_setup_parser())) {
-        log.Fatal("Could not load libpostal")
-    }
+type Config = lifecycle.Config
+
+var libpostal = lifecycle.NewHandle(lifecycle.Core | lifecycle.Parser)
+
+// Setup loads libpostal's core data and address parser model using the
+// directories in config. Calling it is optional; otherwise they are loaded on
+// first use, honoring $GOPOSTAL_DATADIR.
+func Setup(config Config) error {
+    return libpostal.Setup(config)
+}
+
+// Teardown unloads the data files loaded by Setup or on first use, unless
+// another package still uses them.
+func Teardown() {
+    libpostal.Teardown()
+}
+
+// Loaded reports whether the data files the package uses are loaded. They are
+// loaded on first use, and unloaded after Config.IdleTimeout without use.
+func Loaded() bool {
+    return libpostal.Loaded()
 }
 
 type ParserOptions struct {
@@ -38,69 +67,199 @@ func getDefaultParserOptions() ParserOptions {
 var parserDefaultOptions = getDefaultParserOptions()
 
 type ParsedComponent struct {
-    Label string `json:"label"`
+    Label label.Label `json:"label"`
     Value string `json:"value"`
 }
 
-func ParseAddressOptions(address string, options ParserOptions) []ParsedComponent {
-    if !utf8.ValidString(address) {
-        return nil
-    }
-
-    mu.Lock()
-    defer mu.Unlock()
+// Component returns c as a label.Component, as taken by the format package.
+func (c ParsedComponent) Component() label.Component {
+    return label.Component(c)
+}
 
-    cAddress := C.CString(address)
-    defer C.free(unsafe.Pointer(cAddress))
+// LabelComponents returns components as label.Components, e.g. to pass parser
+// output to format.FormatAddress.
+func LabelComponents(components []ParsedComponent) []label.Component {
+    converted := make([]label.Component, len(components))
+    for i, c := range components {
+        converted[i] = c.Component()
+    }
+    return converted
+}
 
+// cParserOptions converts options to libpostal's C struct. The returned
+// function frees the strings it references.
+func cParserOptions(options ParserOptions) (C.libpostal_address_parser_options_t, func()) {
     cOptions := C.libpostal_get_address_parser_default_options()
-    if options.Language != "" {
-        cLanguage := C.CString(options.Language)
-        defer C.free(unsafe.Pointer(cLanguage))
 
+    var cLanguage, cCountry *C.char
+    if options.Language != "" {
+        cLanguage = C.CString(options.Language)
         cOptions.language = cLanguage
     }
 
     if options.Country != "" {
-        cCountry := C.CString(options.Country)
-        defer C.free(unsafe.Pointer(cCountry))
-
+        cCountry = C.CString(options.Country)
         cOptions.country = cCountry
     }
 
-    cAddressParserResponsePtr := C.libpostal_parse_address(cAddress, cOptions)
+    return cOptions, func() {
+        C.free(unsafe.Pointer(cLanguage))
+        C.free(unsafe.Pointer(cCountry))
+    }
+}
+
+// parseAddress runs the parser on a single address. The caller must hold the
+// lock and have loaded the parser.
+func parseAddress(address string, cOptions C.libpostal_address_parser_options_t) ([]ParsedComponent, error) {
+    cAddress := C.CString(address)
+    defer C.free(unsafe.Pointer(cAddress))
+
+    // The whole response comes back in one buffer, which is read in place.
+    // Labels are mapped to the label constants, and the values are copied
+    // into Go together in one allocation.
+    var cSize C.size_t
+    cBuf := C.cbuf_parse_address(cAddress, cOptions, &cSize)
+    if cBuf == nil {
+        return nil, ErrLibpostal
+    }
+    defer C.free(unsafe.Pointer(cBuf))
+
+    r, n, err := cbuf.NewReader(unsafe.String((*byte)(unsafe.Pointer(cBuf)), int(cSize)))
+    if err != nil {
+        return nil, err
+    }
+
+    parsedComponents := make([]ParsedComponent, n/2)
+    for i := range parsedComponents {
+        l, err := r.Next()
+        if err != nil {
+            return nil, err
+        }
+        value, err := r.Next()
+        if err != nil {
+            return nil, err
+        }
+        parsedComponents[i] = ParsedComponent{
+            Label: parsedLabel(l),
+            Value: value,
+        }
+    }
+    cbuf.Clone(len(parsedComponents), func(i int) *string {
+        return &parsedComponents[i].Value
+    })
+
+    return parsedComponents, nil
+}
 
-    if cAddressParserResponsePtr == nil {
-        return nil
+var labelsByName = func() map[string]label.Label {
+    labels := label.Labels()
+    byName := make(map[string]label.Label, len(labels))
+    for _, l := range labels {
+        byName[string(l)] = l
     }
+    return byName
+}()
 
-    cAddressParserResponse := *cAddressParserResponsePtr
+// parsedLabel returns l, a string in C memory, as one of the label constants,
+// or as a copy if libpostal returned a label this package doesn't know.
+func parsedLabel(l string) label.Label {
+    if known, ok := labelsByName[l]; ok {
+        return known
+    }
+    return label.Label(strings.Clone(l))
+}
 
-    cNumComponents := cAddressParserResponse.num_components
-    cComponents := cAddressParserResponse.components
-    cLabels := cAddressParserResponse.labels
+// ParseAddressContext is ParseAddressOptionsE, but gives up waiting for other
+// calls into libpostal and returns ctx.Err() if ctx is done first. Once
+// libpostal starts parsing, it runs to completion.
+func ParseAddressContext(ctx context.Context, address string, options ParserOptions) (parsedComponents []ParsedComponent, err error) {
+    call := hooks.Start("parser.ParseAddress", len(address))
+    defer func() { call.Done(len(parsedComponents), err) }()
 
-    numComponents := uint64(cNumComponents)
+    if !utf8.ValidString(address) {
+        return nil, ErrInvalidUTF8
+    }
 
-    parsedComponents := make([]ParsedComponent, numComponents)
+    cOptions, freeOptions := cParserOptions(options)
+    defer freeOptions()
 
-    // Accessing a C array
-    cComponentsPtr := (*[1<<30](*C.char))(unsafe.Pointer(cComponents))[:numComponents:numComponents]
-    cLabelsPtr := (*[1<<30](*C.char))(unsafe.Pointer(cLabels))[:numComponents:numComponents]
+    if err := call.LockContext(ctx); err != nil {
+        return nil, err
+    }
+    defer lifecycle.Unlock()
 
-    var i uint64
-    for i = 0; i < numComponents; i++ {
-        parsedComponents[i] = ParsedComponent{
-            Label: C.GoString(cLabelsPtr[i]),
-            Value: C.GoString(cComponentsPtr[i]),
-        }
+    if err := libpostal.Ensure(); err != nil {
+        return nil, err
     }
 
-    C.libpostal_address_parser_response_destroy(cAddressParserResponsePtr)
+    return parseAddress(address, cOptions)
+}
 
+func ParseAddressOptionsE(address string, options ParserOptions) ([]ParsedComponent, error) {
+    return ParseAddressContext(context.Background(), address, options)
+}
+
+func ParseAddressOptions(address string, options ParserOptions) []ParsedComponent {
+    parsedComponents, _ := ParseAddressOptionsE(address, options)
     return parsedComponents
 }
 
 func ParseAddress(address string) []ParsedComponent {
     return ParseAddressOptions(address, parserDefaultOptions)
 }
+
+// Number of addresses ParseAddresses parses per acquisition of the lock, so
+// that large batches don't starve other callers.
+const parseBatchSize = 256
+
+// ParseAddresses parses each of addresses with the same options. The error for
+// addresses[i] is in the second slice at index i, and is nil on success.
+func ParseAddresses(addresses []string, options ParserOptions) ([][]ParsedComponent, []error) {
+    results := make([][]ParsedComponent, len(addresses))
+    parseErrors := make([]error, len(addresses))
+
+    cOptions, freeOptions := cParserOptions(options)
+    defer freeOptions()
+
+    for start := 0; start < len(addresses); start += parseBatchSize {
+        end := start + parseBatchSize
+        if end > len(addresses) {
+            end = len(addresses)
+        }
+
+        parseBatch(addresses[start:end], cOptions, results[start:end], parseErrors[start:end])
+    }
+
+    return results, parseErrors
+}
+
+func parseBatch(addresses []string, cOptions C.libpostal_address_parser_options_t, results [][]ParsedComponent, parseErrors []error) {
+    var inputLen, numResults int
+    var err error
+    for _, address := range addresses {
+        inputLen += len(address)
+    }
+
+    call := hooks.Start("parser.ParseAddresses", inputLen)
+    defer func() { call.Done(numResults, err) }()
+
+    call.Lock()
+    defer lifecycle.Unlock()
+
+    if err = libpostal.Ensure(); err != nil {
+        for i := range parseErrors {
+            parseErrors[i] = err
+        }
+        return
+    }
+
+    for i, address := range addresses {
+        if !utf8.ValidString(address) {
+            parseErrors[i] = ErrInvalidUTF8
+            continue
+        }
+
+        results[i], parseErrors[i] = parseAddress(address, cOptions)
+        numResults += len(results[i])
+    }
+}
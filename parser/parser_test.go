@@ -1,9 +1,15 @@
 package postal
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
     "reflect"
     "testing"
+	"time"
+
+	"github.com/openvenues/gopostal/internal/lifecycle"
+	label "github.com/openvenues/gopostal/label"
 )
 
 func testParse(t *testing.T, address string, expectedOutput []ParsedComponent, expectedJSON string) {
@@ -33,6 +39,15 @@ func testParse(t *testing.T, address string, expectedOutput []ParsedComponent, e
     }
 }
 
+func TestSetup(t *testing.T) {
+	if err := Setup(Config{}); err != nil {
+		t.Fatal("Setup error: " + err.Error())
+	}
+	if !Loaded() {
+		t.Error("parser not loaded after Setup")
+	}
+}
+
 func TestParseUSAddress(t *testing.T) {
     t.Log("Testing US address")
 
@@ -50,3 +65,359 @@ func TestParseUSAddress(t *testing.T) {
               `[{"label":"house_number","value":"781"},{"label":"road","value":"franklin ave"},{"label":"suburb","value":"crown heights"},{"label":"city_district","value":"brooklyn"},{"label":"city","value":"nyc"},{"label":"state","value":"ny"},{"label":"postcode","value":"11216"},{"label":"country","value":"usa"}]`,
               )
 }
+
+func TestNewAddress(t *testing.T) {
+	components := []ParsedComponent{
+		{"house_number", "781"},
+		{"road", "franklin ave"},
+		{"city_district", "brooklyn"},
+		{"city", "nyc"},
+		{"road", "eastern pkwy"},
+		{"postcode", "11216"},
+		{"country", "usa"},
+	}
+
+	address := NewAddress(components)
+	expected := Address{
+		HouseNumber:  "781",
+		Road:         "franklin ave",
+		CityDistrict: "brooklyn",
+		City:         "nyc",
+		Postcode:     "11216",
+		Country:      "usa",
+		Extra:        []ParsedComponent{{"road", "eastern pkwy"}},
+	}
+	if !reflect.DeepEqual(address, expected) {
+		t.Errorf("address != expected:\n%+v\n%+v", address, expected)
+	}
+
+	// Fields come back from most to least specific, followed by the extras.
+	expectedComponents := []ParsedComponent{
+		{"house_number", "781"},
+		{"road", "franklin ave"},
+		{"postcode", "11216"},
+		{"city_district", "brooklyn"},
+		{"city", "nyc"},
+		{"country", "usa"},
+		{"road", "eastern pkwy"},
+	}
+	if got := address.Components(); !reflect.DeepEqual(got, expectedComponents) {
+		t.Errorf("components != expected:\n%v\n%v", got, expectedComponents)
+	}
+	if got := NewAddress(address.Components()); !reflect.DeepEqual(got, address) {
+		t.Errorf("round trip != address:\n%+v\n%+v", got, address)
+	}
+
+	if address.Get("road") != "franklin ave" || address.Get("unit") != "" {
+		t.Errorf("unexpected Get results: %q %q", address.Get("road"), address.Get("unit"))
+	}
+
+	marshaledJSON, err := json.Marshal(address)
+	if err != nil {
+		t.Fatal("JSON.marshal error: " + err.Error())
+	}
+	expectedJSON := `{"house_number":"781","road":"franklin ave","postcode":"11216","city_district":"brooklyn","city":"nyc","country":"usa","extra":[{"label":"road","value":"eastern pkwy"}]}`
+	if string(marshaledJSON) != expectedJSON {
+		t.Error("json != expected: ", string(marshaledJSON), "!=", expectedJSON)
+	}
+}
+
+func TestLabelComponents(t *testing.T) {
+	components := []ParsedComponent{{"house_number", "781"}, {"road", "franklin ave"}}
+	expected := []label.Component{{Label: "house_number", Value: "781"}, {Label: "road", Value: "franklin ave"}}
+
+	if converted := LabelComponents(components); !reflect.DeepEqual(converted, expected) {
+		t.Errorf("converted != expected:\n%+v\n%+v", converted, expected)
+	}
+	if converted := LabelComponents(nil); len(converted) != 0 {
+		t.Errorf("expected no components, got %+v", converted)
+	}
+}
+
+func TestParseAddressSpans(t *testing.T) {
+	addresses := []string{
+		"781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA",
+		"12 Rue de l'Église, 75001 Paris",
+		"東京都渋谷区渋谷２丁目２１−１",
+	}
+
+	for _, address := range addresses {
+		spans, err := ParseAddressSpans(address, parserDefaultOptions)
+		if err != nil {
+			t.Fatal("unexpected error: " + err.Error())
+		}
+		if len(spans) == 0 {
+			t.Errorf("%s: expected spans, got none", address)
+			continue
+		}
+		// Alignment must cope with libpostal's actual normalization of each
+		// input, such as full-width digits and inserted spaces.
+		for _, span := range spans {
+			if span.Start < 0 || address[span.Start:span.End] != span.Original {
+				t.Errorf("%s: span %+v does not match input", address, span)
+			}
+		}
+
+		if address == addresses[0] && spans[1].Original != "Franklin Ave" {
+			t.Errorf("expected road %q, got %q", "Franklin Ave", spans[1].Original)
+		}
+	}
+}
+
+func TestAlignComponents(t *testing.T) {
+	type span struct {
+		Start    int
+		End      int
+		Original string
+	}
+
+	tests := []struct {
+		name       string
+		address    string
+		components []ParsedComponent
+		expected   []span
+	}{
+		{
+			"US",
+			"781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA",
+			[]ParsedComponent{
+				{"house_number", "781"},
+				{"road", "franklin ave"},
+				{"suburb", "crown heights"},
+				{"city_district", "brooklyn"},
+				{"city", "nyc"},
+				{"state", "ny"},
+				{"postcode", "11216"},
+				{"country", "usa"},
+			},
+			[]span{
+				{0, 3, "781"},
+				{4, 16, "Franklin Ave"},
+				{17, 30, "Crown Heights"},
+				{31, 39, "Brooklyn"},
+				{40, 43, "NYC"},
+				{44, 46, "NY"},
+				{47, 52, "11216"},
+				{53, 56, "USA"},
+			},
+		},
+		{
+			"Punctuation and whitespace",
+			"781  Franklin Ave.,\tCrown-Heights (Brooklyn), N.Y. 11216",
+			[]ParsedComponent{
+				{"house_number", "781"},
+				{"road", "franklin ave"},
+				{"suburb", "crown heights"},
+				{"city_district", "brooklyn"},
+				{"state", "ny"},
+				{"postcode", "11216"},
+			},
+			[]span{
+				{0, 3, "781"},
+				{5, 17, "Franklin Ave"},
+				{20, 33, "Crown-Heights"},
+				{35, 43, "Brooklyn"},
+				{46, 49, "N.Y"},
+				{51, 56, "11216"},
+			},
+		},
+		{
+			"Accents",
+			"12 Rue de l'Église, 75001 Paris",
+			[]ParsedComponent{
+				{"house_number", "12"},
+				{"road", "rue de l'eglise"},
+				{"postcode", "75001"},
+				{"city", "paris"},
+			},
+			[]span{
+				{0, 2, "12"},
+				{3, 19, "Rue de l'Église"},
+				{21, 26, "75001"},
+				{27, 32, "Paris"},
+			},
+		},
+		{
+			"CJK",
+			"東京都渋谷区渋谷２丁目２１−１",
+			[]ParsedComponent{
+				{"state", "東京都"},
+				{"city_district", "渋谷区"},
+				{"suburb", "渋谷 2丁目"},
+				{"house_number", "21-1"},
+			},
+			[]span{
+				{0, 9, "東京都"},
+				{9, 18, "渋谷区"},
+				{18, 33, "渋谷２丁目"},
+				{33, 45, "２１−１"},
+			},
+		},
+		{
+			"Token boundaries",
+			"10 Main St Nycville NY",
+			[]ParsedComponent{
+				{"house_number", "10"},
+				{"state", "ny"},
+			},
+			[]span{
+				{0, 2, "10"},
+				{20, 22, "NY"},
+			},
+		},
+		{
+			"Partial numbers",
+			"12 Main St, Unit 1",
+			[]ParsedComponent{
+				{"unit", "1"},
+			},
+			[]span{
+				{17, 18, "1"},
+			},
+		},
+		{
+			"Unaligned",
+			"781 Franklin Ave",
+			[]ParsedComponent{
+				{"house_number", "781"},
+				{"city", "brooklyn"},
+				{"road", "franklin ave"},
+			},
+			[]span{
+				{0, 3, "781"},
+				{-1, -1, ""},
+				{4, 16, "Franklin Ave"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		spans := AlignComponents(test.address, test.components)
+		if len(spans) != len(test.expected) {
+			t.Errorf("%s: expected %d spans, got %d", test.name, len(test.expected), len(spans))
+			continue
+		}
+
+		for i, s := range spans {
+			if s.Label != test.components[i].Label || s.Value != test.components[i].Value {
+				t.Errorf("%s: span %d has component %s=%q", test.name, i, s.Label, s.Value)
+			}
+			if got := (span{s.Start, s.End, s.Original}); got != test.expected[i] {
+				t.Errorf("%s: span %d: %+v != %+v", test.name, i, got, test.expected[i])
+			}
+		}
+	}
+}
+
+func TestParseAddressErrors(t *testing.T) {
+	parsedComponents, err := ParseAddressOptionsE("781 Franklin Ave \xff", parserDefaultOptions)
+	if !errors.Is(err, ErrInvalidUTF8) {
+		t.Error("expected ErrInvalidUTF8, got: ", err)
+	}
+	if parsedComponents != nil {
+		t.Error("expected nil components, got: ", parsedComponents)
+	}
+
+	if _, err := ParseAddressOptionsE("781 Franklin Ave", parserDefaultOptions); err != nil {
+		t.Error("unexpected error: " + err.Error())
+	}
+}
+
+func TestParseAddressContext(t *testing.T) {
+	// Hold the lock as a long-running call elsewhere would.
+	lifecycle.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := ParseAddressContext(ctx, "781 Franklin Ave", parserDefaultOptions)
+	lifecycle.Unlock()
+
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("expected context.DeadlineExceeded, got: ", err)
+	}
+
+	if _, err := ParseAddressContext(context.Background(), "781 Franklin Ave", parserDefaultOptions); err != nil {
+		t.Error("unexpected error: " + err.Error())
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	addresses := []string{
+		"781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA",
+		"781 Franklin Ave \xff",
+		"Friedrichstraße 128, Berlin, Germany",
+	}
+
+	results, parseErrors := ParseAddresses(addresses, parserDefaultOptions)
+	if len(results) != len(addresses) || len(parseErrors) != len(addresses) {
+		t.Fatalf("expected %d results and errors, got %d and %d", len(addresses), len(results), len(parseErrors))
+	}
+
+	for i, address := range addresses {
+		expected, expectedErr := ParseAddressOptionsE(address, parserDefaultOptions)
+
+		if !errors.Is(parseErrors[i], expectedErr) {
+			t.Errorf("address %d: error %v != expected %v", i, parseErrors[i], expectedErr)
+		}
+
+		if !reflect.DeepEqual(results[i], expected) {
+			t.Errorf("address %d: parsed != expected: %v != %v", i, results[i], expected)
+		}
+	}
+
+	if !errors.Is(parseErrors[1], ErrInvalidUTF8) {
+		t.Error("expected ErrInvalidUTF8 for invalid input, got: ", parseErrors[1])
+	}
+}
+
+func TestParseAddressesEmpty(t *testing.T) {
+	results, parseErrors := ParseAddresses(nil, parserDefaultOptions)
+	if len(results) != 0 || len(parseErrors) != 0 {
+		t.Errorf("expected empty results, got %v, %v", results, parseErrors)
+	}
+}
+
+var benchmarkAddresses = []string{
+	"781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA",
+	"30 West Twenty-sixth St Fl No. 7, New York, NY 10010",
+	"Friedrichstraße 128, 10117 Berlin, Germany",
+	"15 Rue de la Paix, 75002 Paris, France",
+}
+
+func benchmarkBatch(n int) []string {
+	addresses := make([]string, n)
+	for i := range addresses {
+		addresses[i] = benchmarkAddresses[i%len(benchmarkAddresses)]
+	}
+	return addresses
+}
+
+func BenchmarkParseAddress(b *testing.B) {
+	address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		ParseAddress(address)
+	}
+}
+
+func BenchmarkParseAddressLoop(b *testing.B) {
+	addresses := benchmarkBatch(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, address := range addresses {
+			ParseAddressOptions(address, ParserOptions{Country: "us"})
+		}
+	}
+}
+
+func BenchmarkParseAddresses(b *testing.B) {
+	addresses := benchmarkBatch(1000)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ParseAddresses(addresses, ParserOptions{Country: "us"})
+	}
+}
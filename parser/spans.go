@@ -0,0 +1,173 @@
+package postal
+
+import (
+    "unicode"
+    "unicode/utf8"
+
+    label "github.com/openvenues/gopostal/label"
+)
+
+// ComponentSpan is a parsed component located in the input it was parsed
+// from. Start and End are byte offsets, and Original is the input between
+// them with its original case, accents and inner punctuation. If the value
+// could not be found in the input, Start and End are -1 and Original is "".
+type ComponentSpan struct {
+    Label label.Label `json:"label"`
+    Value string `json:"value"`
+    Start int `json:"start"`
+    End int `json:"end"`
+    Original string `json:"original"`
+}
+
+// ParseAddressSpans parses address and locates each component in it, e.g. to
+// highlight the components in the user's own text.
+func ParseAddressSpans(address string, options ParserOptions) ([]ComponentSpan, error) {
+    parsedComponents, err := ParseAddressOptionsE(address, options)
+    if err != nil {
+        return nil, err
+    }
+    return AlignComponents(address, parsedComponents), nil
+}
+
+// AlignComponents locates each of components in address, in order. libpostal
+// lowercases values, may strip accents, and drops or collapses punctuation and
+// whitespace, so letters and digits are compared case- and accent-insensitively
+// and everything else is skipped on both sides. A component only matches whole
+// tokens of address.
+func AlignComponents(address string, components []ParsedComponent) []ComponentSpan {
+    spans := make([]ComponentSpan, len(components))
+
+    cursor := 0
+    for i, component := range components {
+        spans[i] = ComponentSpan{
+            Label: component.Label,
+            Value: component.Value,
+            Start: -1,
+            End: -1,
+        }
+
+        // Components come out in input order, so each one is searched for
+        // from the end of the previous one.
+        for offset := cursor; offset < len(address); {
+            r, size := utf8.DecodeRuneInString(address[offset:])
+            if !significant(r) || !atBoundary(address, offset) {
+                offset += size
+                continue
+            }
+            // A match must cover whole tokens, so that e.g. "ny" doesn't
+            // match the start of "Nycville", nor "1" the start of "12".
+            if start, end, ok := matchAt(address, offset, component.Value); ok && atBoundary(address, end) {
+                spans[i].Start = start
+                spans[i].End = end
+                spans[i].Original = address[start:end]
+                cursor = end
+                break
+            }
+            offset += size
+        }
+    }
+
+    return spans
+}
+
+// matchAt matches the letters and digits of value against those of address
+// from offset on, returning the span from the first to the last one matched.
+// The rune at offset must itself be a letter or digit.
+func matchAt(address string, offset int, value string) (int, int, bool) {
+    start, end := -1, -1
+
+    i := offset
+    for _, v := range value {
+        if !significant(v) {
+            continue
+        }
+
+        for i < len(address) {
+            r, size := utf8.DecodeRuneInString(address[i:])
+            if significant(r) {
+                break
+            }
+            i += size
+        }
+        if i >= len(address) {
+            return 0, 0, false
+        }
+
+        r, size := utf8.DecodeRuneInString(address[i:])
+        if fold(r) != fold(v) {
+            return 0, 0, false
+        }
+        if start < 0 {
+            start = i
+        }
+        i += size
+        end = i
+    }
+
+    return start, end, start >= 0
+}
+
+// atBoundary reports whether a token can start or end at byte offset i of
+// address. Scripts written without spaces, such as Chinese and Japanese, have
+// a boundary between any two characters.
+func atBoundary(address string, i int) bool {
+    if i == 0 || i == len(address) {
+        return true
+    }
+    before, _ := utf8.DecodeLastRuneInString(address[:i])
+    after, _ := utf8.DecodeRuneInString(address[i:])
+    return !significant(before) || !significant(after) || unspaced(before) || unspaced(after)
+}
+
+func unspaced(r rune) bool {
+    return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai, unicode.Lao, unicode.Khmer, unicode.Myanmar)
+}
+
+func significant(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// Accented Latin letters and the letters they fold to.
+var accentFolds = map[rune]rune{}
+
+func init() {
+    for base, accented := range map[rune]string{
+        'a': "àáâãäåāăą",
+        'c': "çćĉċč",
+        'd': "ďđ",
+        'e': "èéêëēĕėęě",
+        'g': "ĝğġģ",
+        'h': "ĥħ",
+        'i': "ìíîïĩīĭįı",
+        'j': "ĵ",
+        'k': "ķ",
+        'l': "ĺļľŀł",
+        'n': "ñńņňŉ",
+        'o': "òóôõöøōŏő",
+        'r': "ŕŗř",
+        's': "śŝşšș",
+        't': "ţťŧț",
+        'u': "ùúûüũūŭůűų",
+        'w': "ŵ",
+        'y': "ýÿŷ",
+        'z': "źżž",
+    } {
+        for _, r := range accented {
+            accentFolds[r] = base
+        }
+    }
+}
+
+// fold maps r to a canonical form for comparison: lowercase, without accents
+// on Latin letters, and with full-width forms replaced by their ASCII
+// equivalents.
+func fold(r rune) rune {
+    if r >= '！' && r <= '～' {
+        r -= '！' - '!'
+    }
+    r = unicode.ToLower(r)
+    if base, ok := accentFolds[r]; ok {
+        return base
+    }
+    return r
+}
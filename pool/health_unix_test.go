@@ -0,0 +1,39 @@
+//go:build unix
+
+package postal
+
+import (
+	"syscall"
+	"testing"
+	"time"
+
+	parser "github.com/openvenues/gopostal/parser"
+)
+
+func TestPoolHealthCheckHungWorker(t *testing.T) {
+	p, err := New(Config{Workers: 2, HealthCheckInterval: 10 * time.Millisecond, HealthCheckTimeout: 2 * time.Second})
+	if err != nil {
+		t.Fatal("New error: " + err.Error())
+	}
+	defer p.Close()
+
+	// Stop one worker so that its ping hangs until the timeout, and queue it
+	// ahead of the healthy one.
+	hung, healthy := <-p.idle, <-p.idle
+	if err := hung.cmd.Process.Signal(syscall.SIGSTOP); err != nil {
+		t.Fatal(err)
+	}
+	p.idle <- hung
+	p.idle <- healthy
+
+	// Let the health check take the hung worker.
+	time.Sleep(50 * time.Millisecond)
+
+	start := time.Now()
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); err != nil {
+		t.Fatalf("ParseE during health check: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("ParseE waited %v behind the hung worker's health check", elapsed)
+	}
+}
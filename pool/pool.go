@@ -0,0 +1,395 @@
+package postal
+
+import (
+    "bufio"
+    "errors"
+    "fmt"
+    "io"
+    "os"
+    "os/exec"
+    "runtime"
+    "sync"
+    "time"
+
+    expand "github.com/openvenues/gopostal/expand"
+    "github.com/openvenues/gopostal/internal/errs"
+    neardupe "github.com/openvenues/gopostal/neardupe"
+    parser "github.com/openvenues/gopostal/parser"
+)
+
+var (
+    ErrInvalidUTF8 = errs.ErrInvalidUTF8
+    ErrLengthMismatch = errs.ErrLengthMismatch
+    ErrEmptyInput = errs.ErrEmptyInput
+    ErrNotInitialized = errs.ErrNotInitialized
+    ErrLibpostal = errs.ErrLibpostal
+    ErrInvalidLabel = errs.ErrInvalidLabel
+
+    ErrClosed = errors.New("postal: pool is closed")
+    ErrWorkerCrashed = errors.New("postal: pool worker crashed")
+)
+
+type Config struct {
+    // Number of worker processes. Each one loads its own copy of the models
+    // it uses. Defaults to runtime.NumCPU().
+    Workers int
+    // Configuration passed to Setup in each worker.
+    Libpostal parser.Config
+    // How often idle workers are pinged. Defaults to 30 seconds; a negative
+    // value disables health checks.
+    HealthCheckInterval time.Duration
+    // How long a worker may take to answer a ping before it is restarted.
+    // Defaults to 10 seconds.
+    HealthCheckTimeout time.Duration
+    // Program started for each worker, which must call ServeWorker when
+    // IsWorker is true. Defaults to the current executable.
+    Command string
+    Args []string
+}
+
+func GetDefaultPoolConfig() Config {
+    return Config{
+        Workers: runtime.NumCPU(),
+        HealthCheckInterval: 30 * time.Second,
+        HealthCheckTimeout: 10 * time.Second,
+    }
+}
+
+// Pool spreads calls across child processes, each with its own libpostal
+// state, so that they run in parallel instead of serializing on one lock.
+type Pool struct {
+    config Config
+    // Holds one slot per worker; a nil slot is a worker that needs starting.
+    idle chan *worker
+    done chan struct{}
+    closeOnce sync.Once
+    healthCheck sync.WaitGroup
+}
+
+// New starts config.Workers worker processes and returns once all of them are
+// ready.
+func New(config Config) (*Pool, error) {
+    defaults := GetDefaultPoolConfig()
+    if config.Workers <= 0 {
+        config.Workers = defaults.Workers
+    }
+    if config.HealthCheckInterval == 0 {
+        config.HealthCheckInterval = defaults.HealthCheckInterval
+    }
+    if config.HealthCheckTimeout <= 0 {
+        config.HealthCheckTimeout = defaults.HealthCheckTimeout
+    }
+    if config.Command == "" {
+        executable, err := os.Executable()
+        if err != nil {
+            return nil, err
+        }
+        config.Command = executable
+    }
+
+    p := &Pool{
+        config: config,
+        idle: make(chan *worker, config.Workers),
+        done: make(chan struct{}),
+    }
+
+    for i := 0; i < config.Workers; i++ {
+        w, err := p.start()
+        if err != nil {
+            close(p.done)
+            p.stopIdle(i)
+            return nil, err
+        }
+        p.idle <- w
+    }
+
+    if config.HealthCheckInterval > 0 {
+        p.healthCheck.Add(1)
+        go p.checkHealth()
+    }
+
+    return p, nil
+}
+
+// Close waits for calls in progress to finish and stops the workers. Calls
+// made after Close return ErrClosed.
+func (p *Pool) Close() error {
+    p.closeOnce.Do(func() {
+        close(p.done)
+        p.healthCheck.Wait()
+        p.stopIdle(p.config.Workers)
+    })
+    return nil
+}
+
+func (p *Pool) stopIdle(n int) {
+    for i := 0; i < n; i++ {
+        if w := <-p.idle; w != nil {
+            w.stop()
+        }
+    }
+}
+
+type worker struct {
+    cmd *exec.Cmd
+    stdin io.WriteCloser
+    w *bufio.Writer
+    r *bufio.Reader
+    exited chan struct{}
+}
+
+func (p *Pool) start() (*worker, error) {
+    cmd := exec.Command(p.config.Command, p.config.Args...)
+    cmd.Env = append(os.Environ(), workerEnv+"=1")
+    cmd.Stderr = os.Stderr
+
+    stdin, err := cmd.StdinPipe()
+    if err != nil {
+        return nil, err
+    }
+    stdout, err := cmd.StdoutPipe()
+    if err != nil {
+        return nil, err
+    }
+    if err := cmd.Start(); err != nil {
+        return nil, err
+    }
+
+    w := &worker{
+        cmd: cmd,
+        stdin: stdin,
+        w: bufio.NewWriter(stdin),
+        r: bufio.NewReader(stdout),
+        exited: make(chan struct{}),
+    }
+    go func() {
+        cmd.Wait()
+        close(w.exited)
+    }()
+
+    e := &encoder{}
+    e.byte(opSetup)
+    encodeConfig(e, p.config.Libpostal)
+    if _, err := w.call(e.buf); err != nil {
+        w.kill()
+        return nil, fmt.Errorf("postal: starting pool worker: %w", err)
+    }
+
+    return w, nil
+}
+
+// call sends a request and returns the result encoded after the error code.
+// Errors reported by the worker are returned as is; any other error means the
+// worker is no longer usable.
+func (w *worker) call(request []byte) (*decoder, error) {
+    if err := writeFrame(w.w, request); err != nil {
+        return nil, err
+    }
+    response, err := readFrame(w.r)
+    if err != nil {
+        return nil, err
+    }
+
+    d := &decoder{buf: response}
+    if code := d.byte(); code != errOK {
+        msg := d.string()
+        if d.err != nil {
+            return nil, d.err
+        }
+        return nil, codeError(code, msg)
+    }
+    return d, nil
+}
+
+func (w *worker) ping(timeout time.Duration) bool {
+    result := make(chan error, 1)
+    go func() {
+        _, err := w.call([]byte{opPing})
+        result <- err
+    }()
+
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+
+    select {
+    case err := <-result:
+        return err == nil
+    case <-timer.C:
+        return false
+    }
+}
+
+func (w *worker) kill() {
+    w.cmd.Process.Kill()
+    <-w.exited
+}
+
+// stop closes the worker's stdin so it exits on its own, and kills it if it
+// doesn't exit promptly.
+func (w *worker) stop() {
+    w.stdin.Close()
+
+    timer := time.NewTimer(5 * time.Second)
+    defer timer.Stop()
+
+    select {
+    case <-w.exited:
+    case <-timer.C:
+        w.kill()
+    }
+}
+
+// do runs request on an idle worker, starting one first if its slot is empty.
+// A worker that fails mid-request is killed and its slot emptied so the next
+// call starts a replacement.
+func (p *Pool) do(request []byte) (*decoder, error) {
+    select {
+    case <-p.done:
+        return nil, ErrClosed
+    default:
+    }
+
+    var w *worker
+    select {
+    case <-p.done:
+        return nil, ErrClosed
+    case w = <-p.idle:
+    }
+
+    if w == nil {
+        var err error
+        if w, err = p.start(); err != nil {
+            p.idle <- nil
+            return nil, err
+        }
+    }
+
+    d, err := w.call(request)
+    var remote *remoteError
+    if err != nil && !errors.As(err, &remote) {
+        w.kill()
+        p.idle <- nil
+        return nil, fmt.Errorf("%w: %v", ErrWorkerCrashed, err)
+    }
+
+    p.idle <- w
+    return d, err
+}
+
+func (p *Pool) checkHealth() {
+    defer p.healthCheck.Done()
+
+    ticker := time.NewTicker(p.config.HealthCheckInterval)
+    defer ticker.Stop()
+
+    for {
+        select {
+        case <-p.done:
+            return
+        case <-ticker.C:
+        }
+
+        // Only idle workers are checked; busy ones are answering requests.
+        // Slots are taken one at a time and put back before the next, so a
+        // slow ping or restart holds up a single slot rather than all of
+        // them. A slot may be checked twice in a tick while others are busy.
+    check:
+        for i := 0; i < p.config.Workers; i++ {
+            select {
+            case <-p.done:
+                return
+            case w := <-p.idle:
+                p.idle <- p.checkWorker(w)
+            default:
+                break check
+            }
+        }
+    }
+}
+
+// checkWorker pings w, and returns it or, if it failed the ping or its slot
+// was empty, a new worker. It returns nil if the restart fails; do retries it.
+func (p *Pool) checkWorker(w *worker) *worker {
+    if w != nil && !w.ping(p.config.HealthCheckTimeout) {
+        w.kill()
+        w = nil
+    }
+    if w == nil {
+        w, _ = p.start()
+    }
+    return w
+}
+
+func (p *Pool) ParseE(address string, options parser.ParserOptions) ([]parser.ParsedComponent, error) {
+    e := &encoder{}
+    e.byte(opParse)
+    e.string(address)
+    encodeParserOptions(e, options)
+
+    d, err := p.do(e.buf)
+    if err != nil {
+        return nil, err
+    }
+
+    components := decodeComponents(d)
+    if d.err != nil {
+        return nil, d.err
+    }
+    return components, nil
+}
+
+// Parse is parser.ParseAddressOptions run on a worker.
+func (p *Pool) Parse(address string, options parser.ParserOptions) []parser.ParsedComponent {
+    components, _ := p.ParseE(address, options)
+    return components
+}
+
+func (p *Pool) ExpandE(address string, options expand.ExpandOptions) ([]string, error) {
+    e := &encoder{}
+    e.byte(opExpand)
+    e.string(address)
+    encodeExpandOptions(e, options)
+
+    d, err := p.do(e.buf)
+    if err != nil {
+        return nil, err
+    }
+
+    expansions := d.strings()
+    if d.err != nil {
+        return nil, d.err
+    }
+    return expansions, nil
+}
+
+// Expand is expand.ExpandAddressOptions run on a worker.
+func (p *Pool) Expand(address string, options expand.ExpandOptions) []string {
+    expansions, _ := p.ExpandE(address, options)
+    return expansions
+}
+
+func (p *Pool) NearDupeE(labels []string, values []string, options neardupe.NearDupeHashOptions, languages []string) ([]string, error) {
+    e := &encoder{}
+    e.byte(opNearDupe)
+    e.strings(labels)
+    e.strings(values)
+    encodeNearDupeHashOptions(e, options)
+    e.strings(languages)
+
+    d, err := p.do(e.buf)
+    if err != nil {
+        return nil, err
+    }
+
+    hashes := d.strings()
+    if d.err != nil {
+        return nil, d.err
+    }
+    return hashes, nil
+}
+
+// NearDupe is neardupe.NearDupeOptions run on a worker.
+func (p *Pool) NearDupe(labels []string, values []string, options neardupe.NearDupeHashOptions, languages []string) []string {
+    hashes, _ := p.NearDupeE(labels, values, options, languages)
+    return hashes
+}
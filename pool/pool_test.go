@@ -0,0 +1,230 @@
+package postal
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	expand "github.com/openvenues/gopostal/expand"
+	neardupe "github.com/openvenues/gopostal/neardupe"
+	parser "github.com/openvenues/gopostal/parser"
+)
+
+// The test binary doubles as the worker program.
+func TestMain(m *testing.M) {
+	if IsWorker() {
+		if err := ServeWorker(); err != nil {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+func newTestPool(t *testing.T, workers int) *Pool {
+	t.Helper()
+	p, err := New(Config{Workers: workers})
+	if err != nil {
+		t.Fatal("New error: " + err.Error())
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestProtocolRoundTrip(t *testing.T) {
+	expandOptions := expand.GetDefaultExpansionOptions()
+	expandOptions.Languages = []string{"en", "fr"}
+	expandOptions.RomanNumerals = false
+
+	hashOptions := neardupe.GetDefaultNearDupeHashOptions()
+	hashOptions.WithLatlon = true
+	hashOptions.Latitude = 40.6782
+	hashOptions.Longitude = -73.9442
+	hashOptions.GeohashPrecision = 6
+
+	parserOptions := parser.ParserOptions{Language: "en", Country: "us"}
+	components := []parser.ParsedComponent{{Label: "house_number", Value: "781"}, {Label: "road", Value: "franklin ave"}}
+
+	config := parser.Config{DataDir: "/srv/libpostal", ParserDataDir: "/srv/parser", IdleTimeout: 5 * time.Minute}
+
+	e := &encoder{}
+	encodeConfig(e, config)
+	encodeExpandOptions(e, expandOptions)
+	encodeNearDupeHashOptions(e, hashOptions)
+	encodeParserOptions(e, parserOptions)
+	encodeComponents(e, components)
+
+	d := &decoder{buf: e.buf}
+	if got := decodeConfig(d); got != config {
+		t.Errorf("config: %+v != %+v", got, config)
+	}
+	if got := decodeExpandOptions(d); !reflect.DeepEqual(got, expandOptions) {
+		t.Errorf("expand options: %+v != %+v", got, expandOptions)
+	}
+	if got := decodeNearDupeHashOptions(d); got != hashOptions {
+		t.Errorf("hash options: %+v != %+v", got, hashOptions)
+	}
+	if got := decodeParserOptions(d); got != parserOptions {
+		t.Errorf("parser options: %+v != %+v", got, parserOptions)
+	}
+	if got := decodeComponents(d); !reflect.DeepEqual(got, components) {
+		t.Errorf("components: %v != %v", got, components)
+	}
+	if d.err != nil || len(d.buf) != 0 {
+		t.Errorf("decoder err %v with %d bytes left", d.err, len(d.buf))
+	}
+
+	// Truncated input must fail rather than panic.
+	for i := 0; i < len(e.buf); i++ {
+		d := &decoder{buf: e.buf[:i]}
+		decodeConfig(d)
+		decodeExpandOptions(d)
+		decodeNearDupeHashOptions(d)
+		decodeParserOptions(d)
+		decodeComponents(d)
+		if d.err == nil {
+			t.Fatalf("no error decoding %d of %d bytes", i, len(e.buf))
+		}
+	}
+}
+
+func TestPoolMatchesInProcess(t *testing.T) {
+	p := newTestPool(t, 2)
+
+	address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+
+	parserOptions := parser.ParserOptions{}
+	expected, err := parser.ParseAddressOptionsE(address, parserOptions)
+	if err != nil {
+		t.Fatal("ParseAddressOptionsE error: " + err.Error())
+	}
+	if got := p.Parse(address, parserOptions); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Parse: %v != %v", got, expected)
+	}
+
+	expandOptions := expand.GetDefaultExpansionOptions()
+	expansions, err := expand.ExpandAddressOptionsE(address, expandOptions)
+	if err != nil {
+		t.Fatal("ExpandAddressOptionsE error: " + err.Error())
+	}
+	if got := p.Expand(address, expandOptions); !reflect.DeepEqual(got, expansions) {
+		t.Errorf("Expand: %v != %v", got, expansions)
+	}
+
+	labels := []string{"house", "house_number", "road"}
+	values := []string{"Brooklyn Museum", "200", "Eastern Pkwy"}
+	hashOptions := neardupe.GetDefaultNearDupeHashOptions()
+	hashes, err := neardupe.NearDupeOptionsE(labels, values, hashOptions, nil)
+	if err != nil {
+		t.Fatal("NearDupeOptionsE error: " + err.Error())
+	}
+	if got := p.NearDupe(labels, values, hashOptions, nil); !reflect.DeepEqual(got, hashes) {
+		t.Errorf("NearDupe: %v != %v", got, hashes)
+	}
+}
+
+func TestPoolErrors(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	if _, err := p.ParseE("\xff", parser.ParserOptions{}); !errors.Is(err, ErrInvalidUTF8) {
+		t.Errorf("ParseE: expected ErrInvalidUTF8, got %v", err)
+	}
+	if _, err := p.NearDupeE([]string{"house"}, nil, neardupe.GetDefaultNearDupeHashOptions(), nil); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("NearDupeE: expected ErrLengthMismatch, got %v", err)
+	}
+	if _, err := p.NearDupeE([]string{"house_num"}, []string{"10"}, neardupe.GetDefaultNearDupeHashOptions(), nil); !errors.Is(err, ErrInvalidLabel) {
+		t.Errorf("NearDupeE: expected ErrInvalidLabel, got %v", err)
+	}
+
+	// Errors from libpostal leave the worker in place.
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); err != nil {
+		t.Errorf("ParseE after error: %v", err)
+	}
+}
+
+func TestPoolRestartsCrashedWorker(t *testing.T) {
+	p := newTestPool(t, 1)
+
+	w := <-p.idle
+	w.cmd.Process.Kill()
+	<-w.exited
+	p.idle <- w
+
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); !errors.Is(err, ErrWorkerCrashed) {
+		t.Fatalf("expected ErrWorkerCrashed, got %v", err)
+	}
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); err != nil {
+		t.Fatalf("ParseE after restart: %v", err)
+	}
+}
+
+func TestPoolHealthCheck(t *testing.T) {
+	p, err := New(Config{Workers: 1, HealthCheckInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal("New error: " + err.Error())
+	}
+	defer p.Close()
+
+	w := <-p.idle
+	w.cmd.Process.Kill()
+	<-w.exited
+	p.idle <- w
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		w := <-p.idle
+		replaced := w != nil
+		if replaced {
+			select {
+			case <-w.exited:
+				replaced = false
+			default:
+			}
+		}
+		p.idle <- w
+		if replaced {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("crashed worker was not replaced")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); err != nil {
+		t.Fatalf("ParseE after health check: %v", err)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	p := newTestPool(t, 4)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := p.ParseE("781 Franklin Ave Brooklyn NY", parser.ParserOptions{}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestPoolClose(t *testing.T) {
+	p := newTestPool(t, 2)
+
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.ParseE("Brooklyn", parser.ParserOptions{}); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed, got %v", err)
+	}
+}
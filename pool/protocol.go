@@ -0,0 +1,370 @@
+package postal
+
+import (
+    "bufio"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math"
+    "time"
+
+    expand "github.com/openvenues/gopostal/expand"
+    "github.com/openvenues/gopostal/internal/errs"
+    label "github.com/openvenues/gopostal/label"
+    neardupe "github.com/openvenues/gopostal/neardupe"
+    parser "github.com/openvenues/gopostal/parser"
+)
+
+// Messages between a Pool and its workers are frames of a 4-byte big-endian
+// payload length followed by the payload. A request payload starts with an op
+// byte; a response payload starts with an error code byte, followed by the
+// result if the code is errOK or by an error message otherwise. Strings are
+// encoded as a uvarint length followed by their bytes.
+
+const maxFrameSize = 64 << 20
+
+const (
+    opSetup byte = iota + 1
+    opPing
+    opParse
+    opExpand
+    opNearDupe
+)
+
+const (
+    errOK byte = iota
+    errInvalidUTF8
+    errLengthMismatch
+    errEmptyInput
+    errNotInitialized
+    errLibpostal
+    errInvalidLabel
+    errOther
+)
+
+var errorCodes = []struct {
+    code byte
+    err error
+}{
+    {errInvalidUTF8, errs.ErrInvalidUTF8},
+    {errLengthMismatch, errs.ErrLengthMismatch},
+    {errEmptyInput, errs.ErrEmptyInput},
+    {errNotInitialized, errs.ErrNotInitialized},
+    {errLibpostal, errs.ErrLibpostal},
+    {errInvalidLabel, errs.ErrInvalidLabel},
+}
+
+// remoteError is an error returned by a worker. It unwraps to the matching
+// sentinel error so errors.Is works across the process boundary.
+type remoteError struct {
+    msg string
+    err error
+}
+
+func (e *remoteError) Error() string {
+    return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+    return e.err
+}
+
+func errorCode(err error) byte {
+    for _, c := range errorCodes {
+        if errors.Is(err, c.err) {
+            return c.code
+        }
+    }
+    return errOther
+}
+
+func codeError(code byte, msg string) error {
+    for _, c := range errorCodes {
+        if c.code == code {
+            return &remoteError{msg: msg, err: c.err}
+        }
+    }
+    return &remoteError{msg: msg}
+}
+
+func writeFrame(w *bufio.Writer, payload []byte) error {
+    var header [4]byte
+    binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+
+    if _, err := w.Write(header[:]); err != nil {
+        return err
+    }
+    if _, err := w.Write(payload); err != nil {
+        return err
+    }
+    return w.Flush()
+}
+
+func readFrame(r *bufio.Reader) ([]byte, error) {
+    var header [4]byte
+    if _, err := io.ReadFull(r, header[:]); err != nil {
+        return nil, err
+    }
+
+    size := binary.BigEndian.Uint32(header[:])
+    if size > maxFrameSize {
+        return nil, fmt.Errorf("postal: frame of %d bytes exceeds limit", size)
+    }
+
+    payload := make([]byte, size)
+    if _, err := io.ReadFull(r, payload); err != nil {
+        return nil, err
+    }
+    return payload, nil
+}
+
+type encoder struct {
+    buf []byte
+}
+
+func (e *encoder) byte(b byte) {
+    e.buf = append(e.buf, b)
+}
+
+func (e *encoder) uvarint(v uint64) {
+    e.buf = binary.AppendUvarint(e.buf, v)
+}
+
+func (e *encoder) float64(v float64) {
+    e.buf = binary.BigEndian.AppendUint64(e.buf, math.Float64bits(v))
+}
+
+func (e *encoder) string(s string) {
+    e.uvarint(uint64(len(s)))
+    e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) strings(strs []string) {
+    e.uvarint(uint64(len(strs)))
+    for _, s := range strs {
+        e.string(s)
+    }
+}
+
+func (e *encoder) bools(bs ...bool) {
+    var bits uint64
+    for i, b := range bs {
+        if b {
+            bits |= 1 << uint(i)
+        }
+    }
+    e.uvarint(bits)
+}
+
+var errMalformed = errors.New("postal: malformed pool message")
+
+// decoder reads values in the order they were encoded. The first failure is
+// kept in err and later reads return zero values.
+type decoder struct {
+    buf []byte
+    err error
+}
+
+func (d *decoder) byte() byte {
+    if d.err != nil || len(d.buf) < 1 {
+        d.err = errMalformed
+        return 0
+    }
+    b := d.buf[0]
+    d.buf = d.buf[1:]
+    return b
+}
+
+func (d *decoder) uvarint() uint64 {
+    if d.err != nil {
+        return 0
+    }
+    v, n := binary.Uvarint(d.buf)
+    if n <= 0 {
+        d.err = errMalformed
+        return 0
+    }
+    d.buf = d.buf[n:]
+    return v
+}
+
+func (d *decoder) float64() float64 {
+    if d.err != nil || len(d.buf) < 8 {
+        d.err = errMalformed
+        return 0
+    }
+    v := math.Float64frombits(binary.BigEndian.Uint64(d.buf))
+    d.buf = d.buf[8:]
+    return v
+}
+
+func (d *decoder) string() string {
+    n := d.uvarint()
+    if d.err != nil || uint64(len(d.buf)) < n {
+        d.err = errMalformed
+        return ""
+    }
+    s := string(d.buf[:n])
+    d.buf = d.buf[n:]
+    return s
+}
+
+func (d *decoder) strings() []string {
+    n := d.uvarint()
+    // Every string takes at least one byte, which bounds n for bad input.
+    if d.err != nil || uint64(len(d.buf)) < n {
+        d.err = errMalformed
+        return nil
+    }
+    strs := make([]string, n)
+    for i := range strs {
+        strs[i] = d.string()
+    }
+    return strs
+}
+
+func (d *decoder) bools(bs ...*bool) {
+    bits := d.uvarint()
+    for i, b := range bs {
+        *b = bits&(1<<uint(i)) != 0
+    }
+}
+
+func encodeConfig(e *encoder, config parser.Config) {
+    e.string(config.DataDir)
+    e.string(config.ParserDataDir)
+    e.string(config.LanguageClassifierDataDir)
+    e.uvarint(uint64(config.IdleTimeout))
+}
+
+func decodeConfig(d *decoder) parser.Config {
+    var config parser.Config
+    config.DataDir = d.string()
+    config.ParserDataDir = d.string()
+    config.LanguageClassifierDataDir = d.string()
+    config.IdleTimeout = time.Duration(d.uvarint())
+    return config
+}
+
+func encodeParserOptions(e *encoder, options parser.ParserOptions) {
+    e.string(options.Language)
+    e.string(options.Country)
+}
+
+func decodeParserOptions(d *decoder) parser.ParserOptions {
+    var options parser.ParserOptions
+    options.Language = d.string()
+    options.Country = d.string()
+    return options
+}
+
+func encodeExpandOptions(e *encoder, options expand.ExpandOptions) {
+    e.strings(options.Languages)
+    e.uvarint(uint64(options.AddressComponents))
+    e.bools(
+        options.LatinAscii,
+        options.Transliterate,
+        options.StripAccents,
+        options.Decompose,
+        options.Lowercase,
+        options.TrimString,
+        options.ReplaceWordHyphens,
+        options.DeleteWordHyphens,
+        options.ReplaceNumericHyphens,
+        options.DeleteNumericHyphens,
+        options.SplitAlphaFromNumeric,
+        options.DeleteFinalPeriods,
+        options.DeleteAcronymPeriods,
+        options.DropEnglishPossessives,
+        options.DeleteApostrophes,
+        options.ExpandNumex,
+        options.RomanNumerals,
+    )
+}
+
+func decodeExpandOptions(d *decoder) expand.ExpandOptions {
+    var options expand.ExpandOptions
+    options.Languages = d.strings()
+    options.AddressComponents = uint16(d.uvarint())
+    d.bools(
+        &options.LatinAscii,
+        &options.Transliterate,
+        &options.StripAccents,
+        &options.Decompose,
+        &options.Lowercase,
+        &options.TrimString,
+        &options.ReplaceWordHyphens,
+        &options.DeleteWordHyphens,
+        &options.ReplaceNumericHyphens,
+        &options.DeleteNumericHyphens,
+        &options.SplitAlphaFromNumeric,
+        &options.DeleteFinalPeriods,
+        &options.DeleteAcronymPeriods,
+        &options.DropEnglishPossessives,
+        &options.DeleteApostrophes,
+        &options.ExpandNumex,
+        &options.RomanNumerals,
+    )
+    return options
+}
+
+func encodeNearDupeHashOptions(e *encoder, options neardupe.NearDupeHashOptions) {
+    e.bools(
+        options.WithName,
+        options.WithAddress,
+        options.WithUnit,
+        options.WithCityOrEquivalent,
+        options.WithSmallContainingBoundaries,
+        options.WithPostalCode,
+        options.WithLatlon,
+        options.NameAndAddressKeys,
+        options.NameOnlyKeys,
+        options.AddressOnlyKeys,
+    )
+    e.float64(options.Latitude)
+    e.float64(options.Longitude)
+    e.uvarint(uint64(options.GeohashPrecision))
+}
+
+func decodeNearDupeHashOptions(d *decoder) neardupe.NearDupeHashOptions {
+    var options neardupe.NearDupeHashOptions
+    d.bools(
+        &options.WithName,
+        &options.WithAddress,
+        &options.WithUnit,
+        &options.WithCityOrEquivalent,
+        &options.WithSmallContainingBoundaries,
+        &options.WithPostalCode,
+        &options.WithLatlon,
+        &options.NameAndAddressKeys,
+        &options.NameOnlyKeys,
+        &options.AddressOnlyKeys,
+    )
+    options.Latitude = d.float64()
+    options.Longitude = d.float64()
+    options.GeohashPrecision = uint32(d.uvarint())
+    return options
+}
+
+func encodeComponents(e *encoder, components []parser.ParsedComponent) {
+    e.uvarint(uint64(len(components)))
+    for _, c := range components {
+        e.string(string(c.Label))
+        e.string(c.Value)
+    }
+}
+
+func decodeComponents(d *decoder) []parser.ParsedComponent {
+    n := d.uvarint()
+    if d.err != nil || uint64(len(d.buf)) < 2*n {
+        d.err = errMalformed
+        return nil
+    }
+    components := make([]parser.ParsedComponent, n)
+    for i := range components {
+        components[i].Label = label.Label(d.string())
+        components[i].Value = d.string()
+    }
+    return components
+}
@@ -0,0 +1,139 @@
+package postal
+
+import (
+    "bufio"
+    "errors"
+    "io"
+    "os"
+
+    expand "github.com/openvenues/gopostal/expand"
+    neardupe "github.com/openvenues/gopostal/neardupe"
+    parser "github.com/openvenues/gopostal/parser"
+)
+
+// Environment variable set on the child processes started by a Pool.
+const workerEnv = "GOPOSTAL_POOL_WORKER"
+
+// IsWorker reports whether the current process was started by a Pool, in which
+// case main should call ServeWorker instead of running the program.
+func IsWorker() bool {
+    return os.Getenv(workerEnv) == "1"
+}
+
+// ServeWorker answers requests from the parent Pool on stdin and stdout until
+// the parent closes stdin. Nothing else may write to stdout while it runs.
+func ServeWorker() error {
+    r := bufio.NewReader(os.Stdin)
+    w := bufio.NewWriter(os.Stdout)
+
+    s := &workerState{}
+    for {
+        request, err := readFrame(r)
+        if err == io.EOF {
+            return nil
+        } else if err != nil {
+            return err
+        }
+
+        if err := writeFrame(w, s.handle(request)); err != nil {
+            return err
+        }
+    }
+}
+
+// workerState holds the configuration sent by the parent. Each package is set
+// up on its first request so that a worker only loads the models it uses.
+type workerState struct {
+    config parser.Config
+    parserReady bool
+    expandReady bool
+    neardupeReady bool
+}
+
+func (s *workerState) setup(ready *bool, setup func(parser.Config) error) error {
+    if *ready {
+        return nil
+    }
+    if err := setup(s.config); err != nil {
+        return err
+    }
+    *ready = true
+    return nil
+}
+
+func (s *workerState) handle(request []byte) []byte {
+    d := &decoder{buf: request}
+    e := &encoder{}
+
+    var err error
+    switch op := d.byte(); op {
+    case opSetup:
+        s.config = decodeConfig(d)
+    case opPing:
+    case opParse:
+        address := d.string()
+        options := decodeParserOptions(d)
+        if d.err != nil {
+            break
+        }
+        if err = s.setup(&s.parserReady, parser.Setup); err != nil {
+            break
+        }
+
+        var components []parser.ParsedComponent
+        components, err = parser.ParseAddressOptionsE(address, options)
+        if err == nil {
+            e.byte(errOK)
+            encodeComponents(e, components)
+        }
+    case opExpand:
+        address := d.string()
+        options := decodeExpandOptions(d)
+        if d.err != nil {
+            break
+        }
+        if err = s.setup(&s.expandReady, expand.Setup); err != nil {
+            break
+        }
+
+        var expansions []string
+        expansions, err = expand.ExpandAddressOptionsE(address, options)
+        if err == nil {
+            e.byte(errOK)
+            e.strings(expansions)
+        }
+    case opNearDupe:
+        labels := d.strings()
+        values := d.strings()
+        options := decodeNearDupeHashOptions(d)
+        languages := d.strings()
+        if d.err != nil {
+            break
+        }
+        if err = s.setup(&s.neardupeReady, neardupe.Setup); err != nil {
+            break
+        }
+
+        var hashes []string
+        hashes, err = neardupe.NearDupeOptionsE(labels, values, options, languages)
+        if err == nil {
+            e.byte(errOK)
+            e.strings(hashes)
+        }
+    default:
+        err = errors.New("postal: unknown pool op")
+    }
+
+    if d.err != nil {
+        err = d.err
+    }
+
+    if err != nil {
+        e.buf = e.buf[:0]
+        e.byte(errorCode(err))
+        e.string(err.Error())
+    } else if len(e.buf) == 0 {
+        e.byte(errOK)
+    }
+    return e.buf
+}
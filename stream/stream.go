@@ -0,0 +1,270 @@
+package postal
+
+import (
+    "bufio"
+    "context"
+    "encoding/json"
+    "io"
+    "runtime"
+    "strings"
+    "sync"
+
+    expand "github.com/openvenues/gopostal/expand"
+    neardupe "github.com/openvenues/gopostal/neardupe"
+    parser "github.com/openvenues/gopostal/parser"
+    pool "github.com/openvenues/gopostal/pool"
+)
+
+type StreamOptions struct {
+    Parser parser.ParserOptions
+    // Also expand each address.
+    Expand bool
+    ExpandOptions expand.ExpandOptions
+    // Also compute near dupe hashes from the parsed components.
+    NearDupe bool
+    NearDupeOptions neardupe.NearDupeHashOptions
+    NearDupeLanguages []string
+    // Number of lines processed concurrently. Defaults to runtime.NumCPU().
+    Workers int
+    // Maximum number of lines read ahead of the consumer. Defaults to four
+    // per worker.
+    Buffer int
+    // If set, lines are processed on the pool's worker processes rather than
+    // in this one.
+    Pool *pool.Pool
+}
+
+func GetDefaultStreamOptions() StreamOptions {
+    return StreamOptions{
+        ExpandOptions: expand.GetDefaultExpansionOptions(),
+        NearDupeOptions: neardupe.GetDefaultNearDupeHashOptions(),
+        Workers: runtime.NumCPU(),
+    }
+}
+
+// Result holds the output for one input line. Line numbers start at 1. Err is
+// the first error for the line, after which the remaining steps are skipped.
+type Result struct {
+    Line int `json:"line"`
+    Input string `json:"input"`
+    Components []parser.ParsedComponent `json:"components,omitempty"`
+    Expansions []string `json:"expansions,omitempty"`
+    Hashes []string `json:"hashes,omitempty"`
+    Err error `json:"-"`
+}
+
+func (r Result) MarshalJSON() ([]byte, error) {
+    type result Result
+    var errString string
+    if r.Err != nil {
+        errString = r.Err.Error()
+    }
+    return json.Marshal(struct {
+        result
+        Error string `json:"error,omitempty"`
+    }{result(r), errString})
+}
+
+// Stream delivers the results of Process in input order.
+type Stream struct {
+    results chan Result
+    err error
+}
+
+// Results returns the channel results are sent on. It is closed at the end of
+// the input, on a read error or when the context is done, even if a read from
+// the input is still blocked. Close the input to release the reader then.
+func (s *Stream) Results() <-chan Result {
+    return s.results
+}
+
+// Err returns the error that ended the stream early, if any: either the
+// reader's error or the context's. It must be called after Results is closed.
+func (s *Stream) Err() error {
+    return s.err
+}
+
+type job struct {
+    result Result
+    done chan Result
+}
+
+// Process reads newline-delimited addresses from r and parses each one, as
+// well as expanding and hashing it if options ask for that. Blank lines are
+// skipped but still counted. Reading stops while Buffer lines are waiting for
+// the consumer, and errors for a line are reported in its Result without
+// stopping the stream.
+func Process(ctx context.Context, r io.Reader, options StreamOptions) *Stream {
+    if options.Workers <= 0 {
+        options.Workers = runtime.NumCPU()
+    }
+    if options.Buffer <= 0 {
+        options.Buffer = 4 * options.Workers
+    }
+
+    s := &Stream{results: make(chan Result)}
+
+    jobs := make(chan *job)
+    // Jobs in input order; its capacity bounds the lines in flight.
+    pending := make(chan *job, options.Buffer)
+    var readErr error
+
+    go func() {
+        defer close(pending)
+        defer close(jobs)
+        readErr = readLines(ctx, r, jobs, pending)
+    }()
+
+    var workers sync.WaitGroup
+    for i := 0; i < options.Workers; i++ {
+        workers.Add(1)
+        go func() {
+            defer workers.Done()
+            for j := range jobs {
+                j.done <- processLine(ctx, j.result, options)
+            }
+        }()
+    }
+
+    go func() {
+        s.err = deliver(ctx, pending, s.results)
+        if s.err == nil {
+            s.err = readErr
+        }
+        close(s.results)
+
+        // After ctx is done, the reader and workers stop in the background.
+        // The reader may still be blocked in r.Read until r is closed.
+        for range pending {
+        }
+        workers.Wait()
+    }()
+
+    return s
+}
+
+// deliver sends results to out in input order until pending is closed or ctx
+// is done.
+func deliver(ctx context.Context, pending <-chan *job, out chan<- Result) error {
+    for {
+        var j *job
+        select {
+        case next, ok := <-pending:
+            if !ok {
+                return nil
+            }
+            j = next
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+
+        var result Result
+        select {
+        case result = <-j.done:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+
+        select {
+        case out <- result:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+}
+
+func readLines(ctx context.Context, r io.Reader, jobs chan<- *job, pending chan<- *job) error {
+    br := bufio.NewReader(r)
+    for lineNumber := 1; ; lineNumber++ {
+        line, err := br.ReadString('\n')
+        if err != nil && (err != io.EOF || line == "") {
+            if err == io.EOF {
+                return nil
+            }
+            return err
+        }
+
+        line = strings.TrimRight(line, "\r\n")
+        if strings.TrimSpace(line) == "" {
+            continue
+        }
+
+        j := &job{
+            result: Result{Line: lineNumber, Input: line},
+            done: make(chan Result, 1),
+        }
+
+        select {
+        case pending <- j:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+        select {
+        case jobs <- j:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+}
+
+func processLine(ctx context.Context, result Result, options StreamOptions) Result {
+    p := options.Pool
+
+    if p != nil {
+        result.Components, result.Err = p.ParseE(result.Input, options.Parser)
+    } else {
+        result.Components, result.Err = parser.ParseAddressContext(ctx, result.Input, options.Parser)
+    }
+    if result.Err != nil {
+        return result
+    }
+
+    if options.Expand {
+        if p != nil {
+            result.Expansions, result.Err = p.ExpandE(result.Input, options.ExpandOptions)
+        } else {
+            result.Expansions, result.Err = expand.ExpandAddressContext(ctx, result.Input, options.ExpandOptions)
+        }
+        if result.Err != nil {
+            return result
+        }
+    }
+
+    if options.NearDupe {
+        labels, values := neardupe.Components(result.Components)
+
+        if p != nil {
+            result.Hashes, result.Err = p.NearDupeE(labels, values, options.NearDupeOptions, options.NearDupeLanguages)
+        } else {
+            result.Hashes, result.Err = neardupe.NearDupeContext(ctx, labels, values, options.NearDupeOptions, options.NearDupeLanguages)
+        }
+    }
+
+    return result
+}
+
+// WriteJSON runs Process on r and writes each Result to w as a line of JSON,
+// with an "error" field for lines that failed. It returns the first error
+// reading r or writing w.
+func WriteJSON(ctx context.Context, w io.Writer, r io.Reader, options StreamOptions) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    bw := bufio.NewWriter(w)
+    encoder := json.NewEncoder(bw)
+    encoder.SetEscapeHTML(false)
+
+    s := Process(ctx, r, options)
+    for result := range s.Results() {
+        if err := encoder.Encode(result); err != nil {
+            return err
+        }
+    }
+
+    // Keep the results written before a read error or cancellation.
+    flushErr := bw.Flush()
+    if err := s.Err(); err != nil {
+        return err
+    }
+    return flushErr
+}
@@ -0,0 +1,244 @@
+package postal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	parser "github.com/openvenues/gopostal/parser"
+)
+
+func collect(t *testing.T, s *Stream) []Result {
+	t.Helper()
+	var results []Result
+	for result := range s.Results() {
+		results = append(results, result)
+	}
+	return results
+}
+
+func TestProcessPreservesOrder(t *testing.T) {
+	var input strings.Builder
+	for i := 1; i <= 500; i++ {
+		fmt.Fprintf(&input, "%d Franklin Ave Brooklyn NY\n", i)
+	}
+
+	options := GetDefaultStreamOptions()
+	options.Workers = 8
+	options.Buffer = 3
+
+	s := Process(context.Background(), strings.NewReader(input.String()), options)
+	results := collect(t, s)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != 500 {
+		t.Fatalf("expected 500 results, got %d", len(results))
+	}
+	for i, result := range results {
+		expected := fmt.Sprintf("%d Franklin Ave Brooklyn NY", i+1)
+		if result.Line != i+1 || result.Input != expected {
+			t.Fatalf("result %d: line %d %q", i, result.Line, result.Input)
+		}
+		if result.Err != nil {
+			t.Fatalf("line %d: %v", result.Line, result.Err)
+		}
+	}
+}
+
+func TestProcessMatchesParseAddress(t *testing.T) {
+	address := "781 Franklin Ave Crown Heights Brooklyn NYC NY 11216 USA"
+
+	s := Process(context.Background(), strings.NewReader(address), GetDefaultStreamOptions())
+	results := collect(t, s)
+	if len(results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(results))
+	}
+
+	expected := parser.ParseAddressOptions(address, parser.ParserOptions{})
+	if fmt.Sprint(results[0].Components) != fmt.Sprint(expected) {
+		t.Errorf("components: %v != %v", results[0].Components, expected)
+	}
+}
+
+func TestProcessLineNumbers(t *testing.T) {
+	input := "first\r\n\n   \nsecond\n\xff\nthird"
+
+	s := Process(context.Background(), strings.NewReader(input), GetDefaultStreamOptions())
+	results := collect(t, s)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		line  int
+		input string
+	}{
+		{1, "first"},
+		{4, "second"},
+		{5, "\xff"},
+		{6, "third"},
+	}
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d", len(expected), len(results))
+	}
+	for i, e := range expected {
+		if results[i].Line != e.line || results[i].Input != e.input {
+			t.Errorf("result %d: got line %d %q, want line %d %q", i, results[i].Line, results[i].Input, e.line, e.input)
+		}
+	}
+
+	// The invalid line fails on its own.
+	if !errors.Is(results[2].Err, parser.ErrInvalidUTF8) {
+		t.Errorf("expected ErrInvalidUTF8, got %v", results[2].Err)
+	}
+	if results[3].Err != nil {
+		t.Errorf("line after error: %v", results[3].Err)
+	}
+}
+
+func TestProcessReadError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	r := io.MultiReader(strings.NewReader("first\nsecond\n"), iotest.ErrReader(readErr))
+
+	s := Process(context.Background(), r, GetDefaultStreamOptions())
+	results := collect(t, s)
+	if len(results) != 2 {
+		t.Errorf("expected 2 results, got %d", len(results))
+	}
+	if !errors.Is(s.Err(), readErr) {
+		t.Errorf("expected read error, got %v", s.Err())
+	}
+}
+
+func TestProcessCancelDuringRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	s := Process(ctx, pr, GetDefaultStreamOptions())
+	if _, err := io.WriteString(pw, "781 Franklin Ave Brooklyn NY\n"); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Results()
+
+	// The reader is now blocked in Read on the pipe.
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		for range s.Results() {
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Results not closed after cancel with a blocked reader")
+	}
+	if !errors.Is(s.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", s.Err())
+	}
+}
+
+// countingReader records how many lines have been read from it. The reader
+// goroutine may still be reading after Results is closed.
+type countingReader struct {
+	lines atomic.Int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	line := "781 Franklin Ave Brooklyn NY\n"
+	if len(p) < len(line) {
+		return 0, io.ErrShortBuffer
+	}
+	r.lines.Add(1)
+	return copy(p, line), nil
+}
+
+func TestProcessBackpressure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	options := GetDefaultStreamOptions()
+	options.Workers = 2
+	options.Buffer = 4
+
+	r := &countingReader{}
+	s := Process(ctx, r, options)
+
+	// Take a single result, then stop consuming.
+	<-s.Results()
+	time.Sleep(50 * time.Millisecond)
+
+	cancel()
+	for range s.Results() {
+	}
+
+	// Workers, buffered jobs and the reader's own line can run ahead of the
+	// consumer, but not the whole infinite input.
+	if lines, limit := r.lines.Load(), int64(1+options.Workers+options.Buffer+2); lines > limit {
+		t.Errorf("read %d lines ahead of the consumer, limit %d", lines, limit)
+	}
+	if !errors.Is(s.Err(), context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", s.Err())
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	input := "781 Franklin Ave Brooklyn NY\n\xff\n"
+
+	var output bytes.Buffer
+	if err := WriteJSON(context.Background(), &output, strings.NewReader(input), GetDefaultStreamOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 JSON lines, got %d: %q", len(lines), output.String())
+	}
+
+	var first, second map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+		t.Fatal(err)
+	}
+
+	if first["line"] != float64(1) || first["input"] != "781 Franklin Ave Brooklyn NY" {
+		t.Errorf("unexpected first line: %s", lines[0])
+	}
+	if _, ok := first["error"]; ok {
+		t.Errorf("unexpected error in first line: %s", lines[0])
+	}
+	if second["line"] != float64(2) || second["error"] != parser.ErrInvalidUTF8.Error() {
+		t.Errorf("unexpected second line: %s", lines[1])
+	}
+}
+
+func TestWriteJSONFlushesOnError(t *testing.T) {
+	readErr := errors.New("disk on fire")
+	r := io.MultiReader(strings.NewReader("781 Franklin Ave Brooklyn NY\n"), iotest.ErrReader(readErr))
+
+	var output bytes.Buffer
+	if err := WriteJSON(context.Background(), &output, r, GetDefaultStreamOptions()); !errors.Is(err, readErr) {
+		t.Errorf("expected read error, got %v", err)
+	}
+
+	if lines := strings.Count(output.String(), "\n"); lines != 1 {
+		t.Errorf("expected the line before the error to be written, got %q", output.String())
+	}
+}
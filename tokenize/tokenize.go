@@ -0,0 +1,198 @@
+package postal
+
+/*
+#cgo pkg-config: libpostal
+#include <libpostal/libpostal.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+    "unicode/utf8"
+    "unsafe"
+
+    "github.com/openvenues/gopostal/internal/errs"
+)
+
+var ErrInvalidUTF8 = errs.ErrInvalidUTF8
+
+type TokenType uint16
+
+const (
+    TokenEnd TokenType = C.LIBPOSTAL_TOKEN_TYPE_END
+    TokenWord TokenType = C.LIBPOSTAL_TOKEN_TYPE_WORD
+    TokenAbbreviation TokenType = C.LIBPOSTAL_TOKEN_TYPE_ABBREVIATION
+    TokenIdeographicChar TokenType = C.LIBPOSTAL_TOKEN_TYPE_IDEOGRAPHIC_CHAR
+    TokenHangulSyllable TokenType = C.LIBPOSTAL_TOKEN_TYPE_HANGUL_SYLLABLE
+    TokenAcronym TokenType = C.LIBPOSTAL_TOKEN_TYPE_ACRONYM
+    TokenPhrase TokenType = C.LIBPOSTAL_TOKEN_TYPE_PHRASE
+    TokenEmail TokenType = C.LIBPOSTAL_TOKEN_TYPE_EMAIL
+    TokenURL TokenType = C.LIBPOSTAL_TOKEN_TYPE_URL
+    TokenUSPhone TokenType = C.LIBPOSTAL_TOKEN_TYPE_US_PHONE
+    TokenIntlPhone TokenType = C.LIBPOSTAL_TOKEN_TYPE_INTL_PHONE
+    TokenNumeric TokenType = C.LIBPOSTAL_TOKEN_TYPE_NUMERIC
+    TokenOrdinal TokenType = C.LIBPOSTAL_TOKEN_TYPE_ORDINAL
+    TokenRomanNumeral TokenType = C.LIBPOSTAL_TOKEN_TYPE_ROMAN_NUMERAL
+    TokenIdeographicNumber TokenType = C.LIBPOSTAL_TOKEN_TYPE_IDEOGRAPHIC_NUMBER
+    TokenPeriod TokenType = C.LIBPOSTAL_TOKEN_TYPE_PERIOD
+    TokenExclamation TokenType = C.LIBPOSTAL_TOKEN_TYPE_EXCLAMATION
+    TokenQuestionMark TokenType = C.LIBPOSTAL_TOKEN_TYPE_QUESTION_MARK
+    TokenComma TokenType = C.LIBPOSTAL_TOKEN_TYPE_COMMA
+    TokenColon TokenType = C.LIBPOSTAL_TOKEN_TYPE_COLON
+    TokenSemicolon TokenType = C.LIBPOSTAL_TOKEN_TYPE_SEMICOLON
+    TokenPlus TokenType = C.LIBPOSTAL_TOKEN_TYPE_PLUS
+    TokenAmpersand TokenType = C.LIBPOSTAL_TOKEN_TYPE_AMPERSAND
+    TokenAtSign TokenType = C.LIBPOSTAL_TOKEN_TYPE_AT_SIGN
+    TokenPound TokenType = C.LIBPOSTAL_TOKEN_TYPE_POUND
+    TokenEllipsis TokenType = C.LIBPOSTAL_TOKEN_TYPE_ELLIPSIS
+    TokenDash TokenType = C.LIBPOSTAL_TOKEN_TYPE_DASH
+    TokenBreakingDash TokenType = C.LIBPOSTAL_TOKEN_TYPE_BREAKING_DASH
+    TokenHyphen TokenType = C.LIBPOSTAL_TOKEN_TYPE_HYPHEN
+    TokenPunctOpen TokenType = C.LIBPOSTAL_TOKEN_TYPE_PUNCT_OPEN
+    TokenPunctClose TokenType = C.LIBPOSTAL_TOKEN_TYPE_PUNCT_CLOSE
+    TokenDoubleQuote TokenType = C.LIBPOSTAL_TOKEN_TYPE_DOUBLE_QUOTE
+    TokenSingleQuote TokenType = C.LIBPOSTAL_TOKEN_TYPE_SINGLE_QUOTE
+    TokenOpenQuote TokenType = C.LIBPOSTAL_TOKEN_TYPE_OPEN_QUOTE
+    TokenCloseQuote TokenType = C.LIBPOSTAL_TOKEN_TYPE_CLOSE_QUOTE
+    TokenSlash TokenType = C.LIBPOSTAL_TOKEN_TYPE_SLASH
+    TokenBackslash TokenType = C.LIBPOSTAL_TOKEN_TYPE_BACKSLASH
+    TokenGreaterThan TokenType = C.LIBPOSTAL_TOKEN_TYPE_GREATER_THAN
+    TokenLessThan TokenType = C.LIBPOSTAL_TOKEN_TYPE_LESS_THAN
+    TokenOther TokenType = C.LIBPOSTAL_TOKEN_TYPE_OTHER
+    TokenWhitespace TokenType = C.LIBPOSTAL_TOKEN_TYPE_WHITESPACE
+    TokenNewline TokenType = C.LIBPOSTAL_TOKEN_TYPE_NEWLINE
+    TokenInvalidChar TokenType = C.LIBPOSTAL_TOKEN_TYPE_INVALID_CHAR
+)
+
+var tokenTypeNames = map[TokenType]string{
+    TokenEnd: "end",
+    TokenWord: "word",
+    TokenAbbreviation: "abbreviation",
+    TokenIdeographicChar: "ideographic_char",
+    TokenHangulSyllable: "hangul_syllable",
+    TokenAcronym: "acronym",
+    TokenPhrase: "phrase",
+    TokenEmail: "email",
+    TokenURL: "url",
+    TokenUSPhone: "us_phone",
+    TokenIntlPhone: "intl_phone",
+    TokenNumeric: "numeric",
+    TokenOrdinal: "ordinal",
+    TokenRomanNumeral: "roman_numeral",
+    TokenIdeographicNumber: "ideographic_number",
+    TokenPeriod: "period",
+    TokenExclamation: "exclamation",
+    TokenQuestionMark: "question_mark",
+    TokenComma: "comma",
+    TokenColon: "colon",
+    TokenSemicolon: "semicolon",
+    TokenPlus: "plus",
+    TokenAmpersand: "ampersand",
+    TokenAtSign: "at_sign",
+    TokenPound: "pound",
+    TokenEllipsis: "ellipsis",
+    TokenDash: "dash",
+    TokenBreakingDash: "breaking_dash",
+    TokenHyphen: "hyphen",
+    TokenPunctOpen: "punct_open",
+    TokenPunctClose: "punct_close",
+    TokenDoubleQuote: "double_quote",
+    TokenSingleQuote: "single_quote",
+    TokenOpenQuote: "open_quote",
+    TokenCloseQuote: "close_quote",
+    TokenSlash: "slash",
+    TokenBackslash: "backslash",
+    TokenGreaterThan: "greater_than",
+    TokenLessThan: "less_than",
+    TokenOther: "other",
+    TokenWhitespace: "whitespace",
+    TokenNewline: "newline",
+    TokenInvalidChar: "invalid_char",
+}
+
+func (t TokenType) String() string {
+    if name, ok := tokenTypeNames[t]; ok {
+        return name
+    }
+    return "unknown"
+}
+
+// The predicates below mirror the is_*_token macros in libpostal's token_types.h.
+
+func (t TokenType) IsWord() bool {
+    return t == TokenWord || t == TokenAbbreviation || t == TokenIdeographicChar || t == TokenHangulSyllable || t == TokenAcronym
+}
+
+func (t TokenType) IsNumeric() bool {
+    return t >= TokenNumeric && t <= TokenIdeographicNumber
+}
+
+func (t TokenType) IsPunctuation() bool {
+    return t >= TokenPeriod && t < TokenOther
+}
+
+func (t TokenType) IsSpace() bool {
+    return t == TokenWhitespace || t == TokenNewline
+}
+
+// Offset and Length are byte positions in the input string, so
+// input[t.Offset:t.Offset+t.Length] is the text of the token.
+type Token struct {
+    Offset int `json:"offset"`
+    Length int `json:"length"`
+    Type TokenType `json:"type"`
+}
+
+type TokenizerOptions struct {
+    Whitespace bool
+}
+
+func getDefaultTokenizerOptions() TokenizerOptions {
+    return TokenizerOptions{
+        Whitespace: false,
+    }
+}
+
+var tokenizerDefaultOptions = getDefaultTokenizerOptions()
+
+func TokenizeOptions(input string, options TokenizerOptions) ([]Token, error) {
+    if !utf8.ValidString(input) {
+        return nil, ErrInvalidUTF8
+    }
+
+    cInput := C.CString(input)
+    defer C.free(unsafe.Pointer(cInput))
+
+    var cNumTokens = C.size_t(0)
+
+    cTokens := C.libpostal_tokenize(cInput, C.bool(options.Whitespace), &cNumTokens)
+    if cTokens == nil {
+        return []Token{}, nil
+    }
+    defer C.free(unsafe.Pointer(cTokens))
+
+    numTokens := uint64(cNumTokens)
+
+    tokens := make([]Token, numTokens)
+    if numTokens == 0 {
+        return tokens, nil
+    }
+
+    // Accessing a C array
+    cTokensPtr := (*[1<<28]C.libpostal_token_t)(unsafe.Pointer(cTokens))[:numTokens:numTokens]
+
+    var i uint64
+    for i = 0; i < numTokens; i++ {
+        tokens[i] = Token{
+            Offset: int(cTokensPtr[i].offset),
+            Length: int(cTokensPtr[i].len),
+            Type: TokenType(cTokensPtr[i]._type),
+        }
+    }
+
+    return tokens, nil
+}
+
+func Tokenize(input string) ([]Token, error) {
+    return TokenizeOptions(input, tokenizerDefaultOptions)
+}
@@ -0,0 +1,92 @@
+package postal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testTokenize(t *testing.T, input string, options TokenizerOptions, expectedTokens []Token, expectedStrings []string) {
+	tokens, err := TokenizeOptions(input, options)
+	if err != nil {
+		t.Fatalf("TokenizeOptions returned error: %v", err)
+	}
+
+	if !reflect.DeepEqual(tokens, expectedTokens) {
+		t.Errorf("tokens != expected:\nGot:  %v\nWant: %v", tokens, expectedTokens)
+	}
+
+	strs := make([]string, len(tokens))
+	for i, token := range tokens {
+		strs[i] = input[token.Offset : token.Offset+token.Length]
+	}
+
+	if !reflect.DeepEqual(strs, expectedStrings) {
+		t.Errorf("token strings != expected:\nGot:  %q\nWant: %q", strs, expectedStrings)
+	}
+}
+
+func TestTokenizeUSAddress(t *testing.T) {
+	testTokenize(t, "123 Main St, Brooklyn", getDefaultTokenizerOptions(),
+		[]Token{
+			{0, 3, TokenNumeric},
+			{4, 4, TokenWord},
+			{9, 2, TokenWord},
+			{11, 1, TokenComma},
+			{13, 8, TokenWord},
+		},
+		[]string{"123", "Main", "St", ",", "Brooklyn"},
+	)
+}
+
+func TestTokenizeWhitespace(t *testing.T) {
+	testTokenize(t, "123 Main", TokenizerOptions{Whitespace: true},
+		[]Token{
+			{0, 3, TokenNumeric},
+			{3, 1, TokenWhitespace},
+			{4, 4, TokenWord},
+		},
+		[]string{"123", " ", "Main"},
+	)
+}
+
+func TestTokenizeIdeographic(t *testing.T) {
+	testTokenize(t, "東京都", getDefaultTokenizerOptions(),
+		[]Token{
+			{0, 3, TokenIdeographicChar},
+			{3, 3, TokenIdeographicChar},
+			{6, 3, TokenIdeographicChar},
+		},
+		[]string{"東", "京", "都"},
+	)
+}
+
+func TestTokenizeInvalidUTF8(t *testing.T) {
+	tokens, err := Tokenize("\xff\xfe")
+	if err != ErrInvalidUTF8 {
+		t.Errorf("expected ErrInvalidUTF8, got %v", err)
+	}
+	if tokens != nil {
+		t.Errorf("expected nil tokens, got %v", tokens)
+	}
+}
+
+func TestTokenTypeString(t *testing.T) {
+	testCases := map[TokenType]string{
+		TokenWord:            "word",
+		TokenIdeographicChar: "ideographic_char",
+		TokenNumeric:         "numeric",
+		TokenComma:           "comma",
+		TokenWhitespace:      "whitespace",
+		TokenType(9999):      "unknown",
+	}
+
+	for tokenType, expected := range testCases {
+		if tokenType.String() != expected {
+			t.Errorf("TokenType(%d).String() = %q, want %q", uint16(tokenType), tokenType.String(), expected)
+		}
+	}
+
+	if !TokenAbbreviation.IsWord() || !TokenOrdinal.IsNumeric() || !TokenHyphen.IsPunctuation() || !TokenNewline.IsSpace() {
+		t.Error("token type predicates returned unexpected results")
+	}
+}